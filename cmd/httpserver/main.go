@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -8,93 +9,36 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
+	"github.com/delroscol98/httpfromtcp/internal/fileserver"
 	"github.com/delroscol98/httpfromtcp/internal/headers"
 	"github.com/delroscol98/httpfromtcp/internal/request"
 	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/router"
 	"github.com/delroscol98/httpfromtcp/internal/server"
 )
 
 const port = 42069
 
-func handler(w *response.Writer, req *request.Request) {
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		HandlerYourProblem(w, req)
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
-		HandlerMyProblem(w, req)
-	} else if req.RequestLine.RequestTarget == "/" {
-		HandlerRoot(w, req)
-	} else if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		HandlerProxy(w, req)
-	} else if req.RequestLine.RequestTarget == "/video" {
-		handlerVideo(w, req)
+func HandlerYourProblem(w *response.Writer, req *request.Request) error {
+	return server.HandlerError{
+		StatusCode:   response.StatusBadRequest,
+		ErrorMessage: "Your request honestly kinda sucked.",
 	}
 }
 
-func HandlerYourProblem(w *response.Writer, req *request.Request) {
-	err := w.WriteStatusLine(response.StatusBadRequest)
-	if err != nil {
-		log.Fatal(err)
-	}
-	body := []byte(`<html>
-  <head>
-    <title>400 Bad Request</title>
-  </head>
-  <body>
-    <h1>Bad Request</h1>
-    <p>Your request honestly kinda sucked.</p>
-  </body>
-</html>`)
-
-	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
-	err = w.WriteHeaders(h)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = w.WriteBody(body)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func HandlerMyProblem(w *response.Writer, req *request.Request) {
-	err := w.WriteStatusLine(response.StatusInternalServerError)
-	if err != nil {
-		log.Fatal(err)
-	}
-	body := []byte(`<html>
-  <head>
-    <title>500 Internal Server Error</title>
-  </head>
-  <body>
-    <h1>Internal Server Error</h1>
-    <p>Okay, you know what? This one is on me.</p>
-  </body>
-</html>`)
-	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
-	err = w.WriteHeaders(h)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = w.WriteBody(body)
-	if err != nil {
-		log.Fatal(err)
+func HandlerMyProblem(w *response.Writer, req *request.Request) error {
+	return server.HandlerError{
+		StatusCode:   response.StatusInternalServerError,
+		ErrorMessage: "Okay, you know what? This one is on me.",
 	}
 }
 
 func HandlerRoot(w *response.Writer, req *request.Request) {
-	err := w.WriteStatusLine(response.StatusOK)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	body := []byte(`<html>
+	w.Header().Set("Content-Type", "text/html")
+	_, err := w.Write([]byte(`<html>
   <head>
     <title>200 OK</title>
   </head>
@@ -102,132 +46,120 @@ func HandlerRoot(w *response.Writer, req *request.Request) {
     <h1>Success!</h1>
     <p>Your request was an absolute banger.</p>
   </body>
-</html>`)
-
-	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
-	err = w.WriteHeaders(h)
+</html>`))
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = w.WriteBody(body)
-	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
 }
 
-func HandlerProxy(w *response.Writer, req *request.Request) {
-	val := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := fmt.Sprintf("https://httpbin.org/%s", val)
+func HandlerProxy(w *response.Writer, req *request.Request) error {
+	// forwarded still encoded, so an escaped slash such as a%2Fb survives
+	target := "https://httpbin.org/" + req.RawParam("path")
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
 
-	res, err := http.Get(url)
+	res, err := http.Get(target)
 	if err != nil {
-		HandlerMyProblem(w, req)
-		return
+		return fmt.Errorf("Error requesting %s: %w", target, err)
 	}
 	defer res.Body.Close()
 
 	err = w.WriteStatusLine(response.StatusOK)
 	if err != nil {
-		HandlerYourProblem(w, req)
+		return err
 	}
 
 	h := response.GetDefaultHeaders(0)
-	h.Delete("Content-Length")
-	h.Override("Transfer-Encoding", "chunked")
-	h.Override("Trailer", "X-Content-Sha256, X-Content-Length")
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-Sha256, X-Content-Length")
 
 	err = w.WriteHeaders(h)
 	if err != nil {
-		HandlerMyProblem(w, req)
-		return
+		return err
 	}
 
 	var body []byte
+	buffer := make([]byte, 1024)
 	for {
-		buffer := make([]byte, 1024)
 		n, err := res.Body.Read(buffer)
-
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
 		if n > 0 {
-			chunkedLengthLine := fmt.Appendf(make([]byte, 0), "%x\r\n", n)
-			chunkedBodyLine := fmt.Appendf(buffer[:n], "\r\n")
 			body = append(body, buffer[:n]...)
 
-			_, err := w.WriteChunkedBody(chunkedLengthLine)
+			_, err := w.WriteChunkedBody(buffer[:n])
 			if err != nil {
-				fmt.Printf("Error writing chunked body: %v\n", err)
+				return fmt.Errorf("Error writing chunked body: %w", err)
 			}
+		}
 
-			_, err = w.WriteChunkedBody(chunkedBodyLine)
-			if err != nil {
-				fmt.Printf("Error writing chunked body: %v\n", err)
-			}
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
 		}
 	}
 
 	err = w.WriteChunkedBodyDone()
 	if err != nil {
-		fmt.Printf("Error finishing chunked body: %v\n", err)
+		return fmt.Errorf("Error finishing chunked body: %w", err)
 	}
 
 	fmt.Print(string(body))
 
 	trailers := headers.NewHeaders()
-	trailers.Override("X-Content-Sha256", fmt.Sprintf("%x", sha256.Sum256(body)))
-	trailers.Override("X-Content-Length", fmt.Sprintf("%d", len(body)))
+	trailers.Set("X-Content-Sha256", fmt.Sprintf("%x", sha256.Sum256(body)))
+	trailers.Set("X-Content-Length", fmt.Sprintf("%d", len(body)))
 
 	err = w.WriteTrailers(trailers)
 	if err != nil {
-		fmt.Printf("Error writing trailers: %v", err)
+		return fmt.Errorf("Error writing trailers: %w", err)
 	}
 	fmt.Println("Trailers written")
+	return nil
 }
 
-func handlerVideo(w *response.Writer, req *request.Request) {
-	videoBytes, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		HandlerMyProblem(w, req)
-		return
-	}
-
-	err = w.WriteStatusLine(response.StatusOK)
-	if err != nil {
-		return
-	}
-
-	h := response.GetDefaultHeaders(len(videoBytes))
-	h.Override("Content-Type", "video/mp4")
-
-	err = w.WriteHeaders(h)
+func handlerVideo(w *response.Writer, req *request.Request) error {
+	video, err := os.Open("assets/vim.mp4")
 	if err != nil {
-		return
+		return err
 	}
+	defer video.Close()
 
-	_, err = w.WriteBody(videoBytes)
-	if err != nil {
-		return
-	}
+	w.Header().Set("Content-Type", "video/mp4")
+	return response.ServeContent(w, req, video)
 }
 
 func main() {
-	server, err := server.Serve(port, handler)
+	rt := router.New()
+	rt.Use(server.Logger(log.Default()), server.Compress(response.CompressOptions{MinSize: 1024}))
+	rt.Handle("/", HandlerRoot)
+	rt.Handle("/yourproblem", server.HandleErrors(HandlerYourProblem))
+	rt.Handle("/myproblem", server.HandleErrors(HandlerMyProblem))
+	rt.Handle("GET /httpbin/{path...}", server.HandleErrors(HandlerProxy))
+	rt.Handle("GET /video", server.HandleErrors(handlerVideo))
+	rt.Handle("/assets/{path...}", fileserver.Dir("assets", fileserver.Options{Prefix: "/assets"}).Handler())
+
+	server, err := server.Serve(port, rt.Handler(),
+		server.WithReadHeaderTimeout(10*time.Second),
+		server.WithIdleTimeout(60*time.Second),
+	)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
 	log.Println("Server gracefully stopped")
 }
@@ -37,12 +37,17 @@ func main() {
 		fmt.Printf("Request line:\n- Method: %s\n- Target: %s\n- Version: %s\n", method, target, version)
 
 		fmt.Println("Headers:")
-		for key, value := range data.Headers {
+		for key, value := range data.Headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
 
+		body, err := data.ReadBody()
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		fmt.Println("Body:")
-		fmt.Println(string(data.Body))
+		fmt.Println(string(body))
 
 		fmt.Println("Connection has been closed")
 	}
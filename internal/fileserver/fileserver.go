@@ -0,0 +1,303 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/server"
+)
+
+// TimeFormat is the IMF-fixdate format used by Last-Modified and
+// If-Modified-Since.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type SymlinkPolicy int
+
+const (
+	// SymlinksDeny refuses any path that goes through a symbolic link.
+	SymlinksDeny SymlinkPolicy = iota
+	// SymlinksWithinRoot follows links whose target stays inside the root.
+	SymlinksWithinRoot
+	// SymlinksFollow follows every link, even out of the root.
+	SymlinksFollow
+)
+
+type Options struct {
+	// Prefix is removed from the request path before it is looked up, for
+	// a file server mounted below the root of the site.
+	Prefix string
+	// Index is the file served for a directory. Defaults to index.html.
+	Index string
+	// ListDirectories renders an HTML listing for directories without an
+	// index file; otherwise they are answered with 403.
+	ListDirectories bool
+	// Symlinks only applies to servers created with Dir.
+	Symlinks SymlinkPolicy
+}
+
+type FileServer struct {
+	fsys fs.FS
+	root string
+	opts Options
+}
+
+// New serves files from fsys.
+func New(fsys fs.FS, opts Options) *FileServer {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	return &FileServer{fsys: fsys, opts: opts}
+}
+
+// Dir serves files from a directory on disk, applying opts.Symlinks.
+func Dir(root string, opts Options) *FileServer {
+	fileServer := New(os.DirFS(root), opts)
+	fileServer.root = root
+	return fileServer
+}
+
+func (fsrv *FileServer) Handler() server.Handler {
+	return server.HandleErrors(fsrv.serve)
+}
+
+func (fsrv *FileServer) serve(w *response.Writer, req *request.Request) error {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		h := w.Header()
+		h.Set("Allow", "GET, HEAD")
+		h.Set("Content-Type", "text/plain")
+		w.SetStatus(response.StatusMethodNotAllowed)
+		_, err := w.Write([]byte("Method Not Allowed\n"))
+		return err
+	}
+
+	// the prefix has to end on a segment boundary, so /static does not
+	// match /staticfile.txt
+	urlPath, ok := strings.CutPrefix(req.URL.Path, strings.TrimSuffix(fsrv.opts.Prefix, "/"))
+	if !ok || (urlPath != "" && !strings.HasPrefix(urlPath, "/")) {
+		return errNotFound
+	}
+
+	name, err := fsrv.resolve(urlPath)
+	if err != nil {
+		return err
+	}
+
+	info, err := fs.Stat(fsrv.fsys, name)
+	if err != nil {
+		return mapFSError(err)
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			return redirect(w, req.URL.Path+"/")
+		}
+
+		indexName := path.Join(name, fsrv.opts.Index)
+		indexInfo, err := fs.Stat(fsrv.fsys, indexName)
+		if err == nil && !indexInfo.IsDir() {
+			return fsrv.serveFile(w, req, indexName, indexInfo)
+		}
+
+		if !fsrv.opts.ListDirectories {
+			return server.HandlerError{StatusCode: response.StatusForbidden, ErrorMessage: "Directory listing is disabled."}
+		}
+		return fsrv.serveListing(w, name, urlPath)
+	}
+
+	return fsrv.serveFile(w, req, name, info)
+}
+
+var errNotFound = server.HandlerError{StatusCode: response.StatusNotFound, ErrorMessage: "The requested file does not exist."}
+
+// resolve maps an already normalized URL path to a name inside the file
+// system, refusing anything that could reach outside of it.
+func (fsrv *FileServer) resolve(urlPath string) (string, error) {
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", errNotFound
+	}
+
+	name := strings.Trim(urlPath, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", errNotFound
+	}
+
+	if fsrv.root == "" || fsrv.opts.Symlinks == SymlinksFollow || name == "." {
+		return name, nil
+	}
+
+	// walk each component so a link anywhere along the path is caught
+	current := fsrv.root
+	for _, part := range strings.Split(name, "/") {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil {
+			return "", mapFSError(err)
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		if fsrv.opts.Symlinks == SymlinksDeny {
+			return "", errNotFound
+		}
+
+		inside, err := withinRoot(fsrv.root, current)
+		if err != nil || !inside {
+			return "", errNotFound
+		}
+	}
+	return name, nil
+}
+
+func withinRoot(root, target string) (bool, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false, err
+	}
+	realTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(realRoot, realTarget)
+	if err != nil {
+		return false, err
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+func (fsrv *FileServer) serveFile(w *response.Writer, req *request.Request, name string, info fs.FileInfo) error {
+	// validators are derived from the modification time, which file systems
+	// such as embed.FS do not have
+	h := w.Header()
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	var etag string
+	if !info.ModTime().IsZero() {
+		etag = fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+		h.Set("ETag", etag)
+		h.Set("Last-Modified", modTime.Format(TimeFormat))
+	}
+
+	if notModified(req, etag, modTime) {
+		w.SetStatus(response.StatusNotModified)
+		return nil
+	}
+
+	file, err := fsrv.fsys.Open(name)
+	if err != nil {
+		return mapFSError(err)
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(content, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		contentType = DetectContentType(head[:n])
+	}
+	h.Set("Content-Type", contentType)
+
+	return response.ServeContent(w, req, content)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// when it is absent, as RFC 9110 section 13.2.2 orders them.
+func notModified(req *request.Request, etag string, modTime time.Time) bool {
+	if modTime.IsZero() {
+		return false
+	}
+
+	if ifNoneMatch, ok := req.Headers.Get("If-None-Match"); ok {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, ok := req.Headers.Get("If-Modified-Since")
+	if !ok {
+		return false
+	}
+	since, err := time.Parse(TimeFormat, ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !modTime.After(since)
+}
+
+func (fsrv *FileServer) serveListing(w *response.Writer, name, urlPath string) error {
+	entries, err := fs.ReadDir(fsrv.fsys, name)
+	if err != nil {
+		return mapFSError(err)
+	}
+
+	title := html.EscapeString(urlPath)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n  <body>\n    <h1>Index of %s</h1>\n    <ul>\n", title, title)
+	if urlPath != "/" {
+		fmt.Fprintf(w, "      <li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := (&url.URL{Path: entryName}).EscapedPath()
+		fmt.Fprintf(w, "      <li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	_, err = fmt.Fprintf(w, "    </ul>\n  </body>\n</html>\n")
+	return err
+}
+
+func redirect(w *response.Writer, location string) error {
+	w.Header().Set("Location", (&url.URL{Path: location}).EscapedPath())
+	w.SetStatus(response.StatusMovedPermanently)
+	return nil
+}
+
+func mapFSError(err error) error {
+	switch {
+	// a path through a regular file, a name too long or a link loop can never
+	// name a file either
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR),
+		errors.Is(err, syscall.ENAMETOOLONG), errors.Is(err, syscall.ELOOP):
+		return errNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return server.HandlerError{StatusCode: response.StatusForbidden, ErrorMessage: "Access to the requested file is forbidden."}
+	default:
+		return err
+	}
+}
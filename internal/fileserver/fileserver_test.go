@@ -0,0 +1,173 @@
+package fileserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/delroscol98/httpfromtcp/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"hello.txt":         {Data: []byte("hello world"), ModTime: modTime},
+		"page":              {Data: []byte("<!DOCTYPE html><p>hi</p>"), ModTime: modTime},
+		"docs/index.html":   {Data: []byte("<h1>docs</h1>"), ModTime: modTime},
+		"empty/a b.txt":     {Data: []byte("a"), ModTime: modTime},
+		"empty/sub/<x>.txt": {Data: []byte("x"), ModTime: modTime},
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	fsrv := New(testFS(), Options{})
+
+	// Test: File with validators and a type from its extension
+	res := servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, res, "Last-Modified: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.Contains(t, res, "ETag: \"")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nhello world"))
+
+	// Test: Type sniffed from the content
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/page", "")
+	assert.Contains(t, res, "Content-Type: text/html; charset=utf-8\r\n")
+
+	// Test: Directory serves its index, and is redirected to the slash form
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/docs/", "")
+	assert.True(t, strings.HasSuffix(res, "<h1>docs</h1>"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/docs", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, res, "Location: /docs/\r\n")
+
+	// Test: Listing is off by default
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/empty/", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 403 Forbidden\r\n"))
+
+	// Test: Missing file and unsupported method
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/nope.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "POST", "/hello.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: GET, HEAD\r\n")
+
+	// Test: HEAD and ranges go through ServeContent
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "Range: bytes=0-4\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nhello"))
+}
+
+func TestFileServerListing(t *testing.T) {
+	fsrv := New(testFS(), Options{ListDirectories: true})
+
+	res := servertest.Serve(t, fsrv.Handler(), "GET", "/empty/", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, res, `<a href="../">../</a>`)
+	assert.Contains(t, res, `<a href="a%20b.txt">a b.txt</a>`)
+	assert.Contains(t, res, `<a href="sub/">sub/</a>`)
+
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/empty/sub/", "")
+	assert.Contains(t, res, `<a href="%3Cx%3E.txt">&lt;x&gt;.txt</a>`)
+}
+
+func TestFileServerConditional(t *testing.T) {
+	fsrv := New(testFS(), Options{})
+	res := servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "")
+	_, rest, _ := strings.Cut(res, "ETag: ")
+	etag, _, _ := strings.Cut(rest, "\r\n")
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "If-None-Match: \"other\", "+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, res, "ETag: "+etag+"\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "If-None-Match: W/"+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 304 Not Modified\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "If-None-Match: \"other\"\r\nIf-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Modified-Since
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 304 Not Modified\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/hello.txt", "If-Modified-Since: Fri, 01 Mar 2024 11:59:59 GMT\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+}
+
+func TestFileServerPaths(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("inside"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "file.txt"), filepath.Join(root, "inner.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "outer.txt")))
+
+	// Test: Mounted below a prefix
+	fsrv := Dir(root, Options{Prefix: "/static"})
+	res := servertest.Serve(t, fsrv.Handler(), "GET", "/static/file.txt", "")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ninside"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/file.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: The prefix only matches whole segments
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/staticfile.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, res, "Location: /static/\r\n")
+
+	// Test: A path through a regular file is not found
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/file.txt/x", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Traversal cannot leave the root
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/../../"+filepath.Base(outside)+"/secret.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/%2e%2e/secret.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/..%5Csecret.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Symlink policies
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/inner.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	fsrv = Dir(root, Options{Prefix: "/static", Symlinks: SymlinksWithinRoot})
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/inner.txt", "")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ninside"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/outer.txt", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	fsrv = Dir(root, Options{Prefix: "/static", Symlinks: SymlinksFollow})
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/outer.txt", "")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nsecret"))
+	res = servertest.Serve(t, fsrv.Handler(), "GET", "/static/file.txt/x", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		data        string
+		contentType string
+	}{
+		{"\x89PNG\r\n\x1a\nrest", "image/png"},
+		{"%PDF-1.7", "application/pdf"},
+		{"\x00\x00\x00\x18ftypmp42", "video/mp4"},
+		{"  <HTML><body>", "text/html; charset=utf-8"},
+		{"<bold>", "text/plain; charset=utf-8"},
+		{"<?xml version=\"1.0\"?>", "text/xml; charset=utf-8"},
+		{"plain text\n", "text/plain; charset=utf-8"},
+		{"caf\xc3", "text/plain; charset=utf-8"},
+		{"\x00\x01\x02binary", "application/octet-stream"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.contentType, DetectContentType([]byte(tc.data)), tc.data)
+	}
+}
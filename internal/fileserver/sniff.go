@@ -0,0 +1,92 @@
+package fileserver
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file DetectContentType looks at.
+const sniffLen = 512
+
+type signature struct {
+	offset      int
+	prefix      []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+	{0, []byte("\x00\x00\x01\x00"), "image/x-icon"},
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("OggS\x00"), "application/ogg"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/x-gzip"},
+	{0, []byte("wOFF"), "font/woff"},
+	{0, []byte("wOF2"), "font/woff2"},
+}
+
+var htmlPrefixes = []string{
+	"<!doctype html", "<html", "<head", "<body", "<script", "<iframe",
+	"<h1", "<div", "<font", "<table", "<a", "<style", "<title", "<b",
+	"<br", "<p", "<!--",
+}
+
+// DetectContentType guesses the media type of data, of which at most the
+// first 512 bytes are considered, from well-known file signatures. Text that
+// is not recognised as HTML or XML is text/plain; anything else is
+// application/octet-stream.
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.prefix) && bytes.Equal(data[sig.offset:sig.offset+len(sig.prefix)], sig.prefix) {
+			return sig.contentType
+		}
+	}
+
+	text := bytes.TrimLeft(data, "\t\n\x0c\r ")
+	lower := bytes.ToLower(text)
+	for _, prefix := range htmlPrefixes {
+		// the tag must end right after its name, so "<bold" is not "<b"
+		if bytes.HasPrefix(lower, []byte(prefix)) && (len(lower) == len(prefix) || isTagEnd(lower[len(prefix)]) || prefix == "<!--") {
+			return "text/html; charset=utf-8"
+		}
+	}
+	if bytes.HasPrefix(text, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+func isTagEnd(c byte) bool {
+	return c == ' ' || c == '>'
+}
+
+// isText reports whether data looks like UTF-8 text. A multi-byte sequence
+// cut off at the end of the sniffed prefix is tolerated.
+func isText(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(data)
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\x0c' && r != '\x1b' {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
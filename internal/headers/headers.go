@@ -2,53 +2,145 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"iter"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers holds header fields in the order they were first added. Each field
+// keeps its values as a list so repeated fields are not merged, which matters
+// for fields such as Set-Cookie that cannot be combined. Names are stored in
+// lowercase and looked up case-insensitively.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name   string
+	values []string
+}
 
 const (
 	CRLF = "\r\n"
 )
 
-func NewHeaders() Headers {
-	return make(Headers)
+var (
+	ErrMalformedHeader = errors.New("Poorly formatted header")
+	ErrInvalidKey      = errors.New("Invalid key")
+	ErrInvalidValue    = errors.New("invalid field value")
+	ErrHeaderTooLarge  = errors.New("header fields too large")
+)
+
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	lineEnd := bytes.Index(data, []byte(CRLF))
+// ParseOptions relaxes Parse for senders that do not follow RFC 9112. The
+// zero value is strict.
+type ParseOptions struct {
+	// AllowBareLF accepts lines ending in LF alone as well as CRLF.
+	AllowBareLF bool
+	// AllowObsFold accepts field values continued on lines starting with a
+	// space or tab, replacing each fold with a single space.
+	AllowObsFold bool
+}
+
+// LineEnd finds the end of the first line in data. It returns the length of
+// the line and the offset just past its terminator, or -1 and -1 when no
+// complete line is present. Only CRLF ends a line unless allowBareLF is set.
+func LineEnd(data []byte, allowBareLF bool) (int, int) {
+	if !allowBareLF {
+		idx := bytes.Index(data, []byte(CRLF))
+		if idx == -1 {
+			return -1, -1
+		}
+		return idx, idx + 2
+	}
+
+	idx := bytes.IndexByte(data, '\n')
+	if idx == -1 {
+		return -1, -1
+	}
+	if idx > 0 && data[idx-1] == '\r' {
+		return idx - 1, idx + 1
+	}
+	return idx, idx + 1
+}
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	return h.ParseWith(data, ParseOptions{})
+}
+
+// ParseWith is Parse with the leniencies selected in opts.
+func (h *Headers) ParseWith(data []byte, opts ParseOptions) (n int, done bool, err error) {
+	lineEnd, next := LineEnd(data, opts.AllowBareLF)
 	if lineEnd == -1 {
 		return 0, false, nil
 	}
 
 	if lineEnd == 0 {
-		return 2, true, nil
+		return next, true, nil
 	}
 
 	line := data[:lineEnd]
+	// without obs-fold a line starting with whitespace cannot be told apart
+	// from a continuation another hop would join to the previous field
+	if !opts.AllowObsFold && (line[0] == ' ' || line[0] == '\t') {
+		return 0, false, fmt.Errorf("%w: %s", ErrMalformedHeader, string(line))
+	}
+
 	colonIdx := bytes.Index(line, []byte(":"))
-	if colonIdx == 0 {
-		return 0, true, fmt.Errorf("Poorly formatted header: %s", string(data))
+	if colonIdx <= 0 {
+		return 0, false, fmt.Errorf("%w: %s", ErrMalformedHeader, string(line))
 	}
 
 	prev := data[colonIdx-1]
 	if prev == ' ' || prev == '\t' {
-		return 0, false, fmt.Errorf("Poorly formatted header: %s", string(data))
+		return 0, false, fmt.Errorf("%w: %s", ErrMalformedHeader, string(line))
 	}
 
 	key := strings.TrimSpace(strings.ToLower(string(line[:colonIdx])))
 	if !h.ValidateKey(key) {
-		return 0, false, fmt.Errorf("Invalid key: %s", key)
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	value := strings.Trim(string(line[colonIdx+1:]), " \t")
+
+	// a folded value only ends at a line that does not start with
+	// whitespace, so the next line has to be seen first
+	for opts.AllowObsFold {
+		rest := data[next:]
+		if len(rest) == 0 {
+			return 0, false, nil
+		}
+		if rest[0] != ' ' && rest[0] != '\t' {
+			break
+		}
+
+		foldEnd, foldNext := LineEnd(rest, opts.AllowBareLF)
+		if foldEnd == -1 {
+			return 0, false, nil
+		}
+		continuation := strings.Trim(string(rest[:foldEnd]), " \t")
+		switch {
+		case value == "":
+			value = continuation
+		case continuation != "":
+			value += " " + continuation
+		}
+		next += foldNext
 	}
-	value := strings.TrimSpace(string(line[colonIdx+1:]))
 
-	h.SetHeaders(key, value)
+	if !ValidateValue(value) {
+		return 0, false, fmt.Errorf("%w for %s: %q", ErrInvalidValue, key, value)
+	}
+
+	h.Add(key, value)
 
-	return lineEnd + 2, false, nil
+	return next, false, nil
 }
 
-func (h Headers) ValidateKey(key string) bool {
+func (h *Headers) ValidateKey(key string) bool {
 	specialChars := "!#$%&'*+-.^_`|~"
 	for _, char := range key {
 		if (char < 'a' || char > 'z') &&
@@ -61,28 +153,157 @@ func (h Headers) ValidateKey(key string) bool {
 	return true
 }
 
-func (h Headers) SetHeaders(key, value string) {
-	val, exists := h[strings.ToLower(key)]
-	if exists {
-		h[strings.ToLower(key)] = fmt.Sprintf("%s, %s", val, value)
-	} else {
-		h[strings.ToLower(key)] = value
+// ValidateValue reports whether value is a valid field-value as defined in
+// RFC 9110 section 5.5: visible characters, spaces, tabs and obs-text, with
+// no leading or trailing whitespace. Control characters such as NUL, CR and
+// LF are rejected, which keeps values from splitting a message.
+func ValidateValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
 	}
+	return value == strings.Trim(value, " \t")
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	value, exists := h[strings.ToLower(key)]
-	if !exists {
+// Validate checks every field name and value, returning an error that names
+// the first invalid field.
+func (h *Headers) Validate() error {
+	for name, value := range h.All() {
+		if name == "" || !h.ValidateKey(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, name)
+		}
+		if !ValidateValue(value) {
+			return fmt.Errorf("%w for %s: %q", ErrInvalidValue, CanonicalKey(name), value)
+		}
+	}
+	return nil
+}
+
+func (h *Headers) find(key string) int {
+	if h == nil {
+		return -1
+	}
+	key = strings.ToLower(key)
+	for i, f := range h.fields {
+		if f.name == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends value to the field's values, adding the field after the
+// existing ones if it is new.
+func (h *Headers) Add(key, value string) {
+	i := h.find(key)
+	if i == -1 {
+		h.fields = append(h.fields, field{name: strings.ToLower(key), values: []string{value}})
+		return
+	}
+	h.fields[i].values = append(h.fields[i].values, value)
+}
+
+// Set replaces the field's values with value, keeping the field's position.
+func (h *Headers) Set(key, value string) {
+	i := h.find(key)
+	if i == -1 {
+		h.Add(key, value)
+		return
+	}
+	h.fields[i].values = []string{value}
+}
+
+func (h *Headers) Del(key string) {
+	i := h.find(key)
+	if i != -1 {
+		h.fields = append(h.fields[:i], h.fields[i+1:]...)
+	}
+}
+
+// Values returns every value of the field in the order they were added.
+func (h *Headers) Values(key string) []string {
+	i := h.find(key)
+	if i == -1 {
+		return nil
+	}
+	return h.fields[i].values
+}
+
+// Get returns the field's values combined into one, separated by ", ".
+func (h *Headers) Get(key string) (string, bool) {
+	values := h.Values(key)
+	if values == nil {
 		return "", false
-	} else {
-		return value, true
+	}
+	return strings.Join(values, ", "), true
+}
+
+// Len returns the number of distinct fields.
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All yields the field lines to serialize, in insertion order. The values of
+// a field are combined into one line, except for Set-Cookie whose values are
+// each sent on their own line since they may contain commas.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if f.name == "set-cookie" {
+				for _, value := range f.values {
+					if !yield(f.name, value) {
+						return
+					}
+				}
+				continue
+			}
+
+			if !yield(f.name, strings.Join(f.values, ", ")) {
+				return
+			}
+		}
 	}
 }
 
-func (h Headers) Override(key, value string) {
-	h[strings.ToLower(key)] = value
+// canonicalExceptions are names whose usual spelling does not follow the
+// capitalize-each-word rule.
+var canonicalExceptions = map[string]string{
+	"etag":             "ETag",
+	"te":               "TE",
+	"www-authenticate": "WWW-Authenticate",
+	"content-md5":      "Content-MD5",
+	"dnt":              "DNT",
 }
 
-func (h Headers) Delete(key string) {
-	delete(h, strings.ToLower(key))
+// CanonicalKey returns the conventional capitalization of a field name, with
+// the first letter and every letter following a hyphen in upper case, as in
+// Content-Length. Names that are not valid tokens are returned unchanged.
+func CanonicalKey(key string) string {
+	if name, ok := canonicalExceptions[strings.ToLower(key)]; ok {
+		return name
+	}
+	if key == "" || !(*Headers)(nil).ValidateKey(key) {
+		return key
+	}
+
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && c >= 'a' && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && c >= 'A' && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
 }
@@ -14,18 +14,18 @@ func TestParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid single header with extra whitespace
 	headers = NewHeaders()
-	data = []byte("       Host: localhost:42069       \r\n\r\n")
+	data = []byte("Host:       localhost:42069       \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, 37, n)
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, 36, n)
 	assert.False(t, done)
 
 	// Test: Valid done
@@ -38,13 +38,14 @@ func TestParse(t *testing.T) {
 	assert.True(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Add("Host", "localhost:42069")
 	data = []byte("User-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "localhost:42069", headers["host"])
-	require.Equal(t, "curl/7.81.0", headers["user-agent"])
+	require.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	require.Equal(t, []string{"curl/7.81.0"}, headers.Values("user-agent"))
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
 
@@ -54,17 +55,18 @@ func TestParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid multiple field value for a field name.
-	headers = map[string]string{"set-person": "lane-loves-go"}
+	headers = NewHeaders()
+	headers.Add("Set-Person", "lane-loves-go")
 	data = []byte("Set-Person: prime-loves-zig\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "lane-loves-go, prime-loves-zig", headers["set-person"])
+	assert.Equal(t, []string{"lane-loves-go", "prime-loves-zig"}, headers.Values("set-person"))
 	assert.Equal(t, 29, n)
 	assert.False(t, done)
 
@@ -84,3 +86,145 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 }
+
+func TestParseFieldValue(t *testing.T) {
+	// Test: Control characters in values are rejected with the field's name
+	for _, value := range []string{"a\x00b", "a\rb", "a\nb", "a\x1bb", "a\x7fb"} {
+		headers := NewHeaders()
+		n, done, err := headers.Parse([]byte("X-Test: " + value + "\r\n\r\n"))
+		require.ErrorIs(t, err, ErrInvalidValue, value)
+		assert.Contains(t, err.Error(), "x-test")
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+	}
+
+	// Test: Tabs, inner spaces and obs-text are allowed
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Test:\tcaf\xc3\xa9 au\tlait \r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"caf\xc3\xa9 au\tlait"}, headers.Values("x-test"))
+}
+
+func TestParseWith(t *testing.T) {
+	// Test: Bare LF only ends a line when allowed
+	headers := NewHeaders()
+	n, done, err := headers.Parse([]byte("Host: localhost\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	n, done, err = headers.ParseWith([]byte("Host: localhost\n\n"), ParseOptions{AllowBareLF: true})
+	require.NoError(t, err)
+	assert.Equal(t, 16, n)
+	assert.False(t, done)
+	assert.Equal(t, []string{"localhost"}, headers.Values("host"))
+
+	// Test: A folded line is malformed unless obs-fold is allowed
+	headers = NewHeaders()
+	data := []byte("X-Long: a\r\n b\r\n\tc\r\nHost: localhost\r\n\r\n")
+	_, _, err = headers.Parse(data[11:])
+	require.ErrorIs(t, err, ErrMalformedHeader)
+	n, _, err = headers.Parse([]byte(" Host: x\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedHeader)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, headers.Len())
+
+	n, done, err = headers.ParseWith(data, ParseOptions{AllowObsFold: true})
+	require.NoError(t, err)
+	assert.Equal(t, 19, n)
+	assert.False(t, done)
+	assert.Equal(t, []string{"a b c"}, headers.Values("x-long"))
+
+	// Test: A value waits for the next line before it is complete
+	headers = NewHeaders()
+	n, done, err = headers.ParseWith([]byte("X-Long: a\r\n"), ParseOptions{AllowObsFold: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+	assert.Equal(t, 0, headers.Len())
+}
+
+func TestValidate(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Content-Type", "text/plain")
+	require.NoError(t, headers.Validate())
+
+	// Test: CRLF injection through a value
+	headers.Set("Location", "/next\r\nSet-Cookie: admin=1")
+	err := headers.Validate()
+	require.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), "Location")
+
+	// Test: Invalid and empty names, and values with surrounding whitespace
+	for _, set := range []func(h *Headers){
+		func(h *Headers) { h.Set("Bad Name", "x") },
+		func(h *Headers) { h.Set("X-Bad:", "x") },
+		func(h *Headers) { h.Set("", "x") },
+	} {
+		headers = NewHeaders()
+		set(headers)
+		assert.ErrorIs(t, headers.Validate(), ErrInvalidKey)
+	}
+	headers = NewHeaders()
+	headers.Set("X-Padded", " x")
+	assert.ErrorIs(t, headers.Validate(), ErrInvalidValue)
+}
+
+func TestHeadersValues(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Content-Type", "text/plain")
+	headers.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	headers.Add("Accept", "text/html")
+	headers.Add("set-cookie", "b=2")
+	headers.Add("ACCEPT", "*/*")
+
+	// Test: Values keep their order and lookups ignore case
+	assert.Equal(t, []string{"text/html", "*/*"}, headers.Values("Accept"))
+	value, ok := headers.Get("accept")
+	assert.True(t, ok)
+	assert.Equal(t, "text/html, */*", value)
+	assert.Nil(t, headers.Values("X-Missing"))
+	assert.Equal(t, 3, headers.Len())
+
+	// Test: Set-Cookie values are serialized as separate lines
+	var lines []string
+	for key, value := range headers.All() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{
+		"content-type: text/plain",
+		"set-cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT",
+		"set-cookie: b=2",
+		"accept: text/html, */*",
+	}, lines)
+
+	// Test: Set keeps the field's position, Del removes every value
+	headers.Set("Content-Type", "application/json")
+	headers.Del("Set-Cookie")
+	lines = nil
+	for key, value := range headers.All() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{"content-type: application/json", "accept: text/html, */*"}, lines)
+
+	// Test: Set adds a new field at the end
+	headers.Set("Vary", "Accept-Encoding")
+	assert.Equal(t, []string{"Accept-Encoding"}, headers.Values("vary"))
+	assert.Equal(t, 3, headers.Len())
+}
+
+func TestCanonicalKey(t *testing.T) {
+	tests := map[string]string{
+		"content-length":   "Content-Length",
+		"CONTENT-TYPE":     "Content-Type",
+		"x-forwarded-for":  "X-Forwarded-For",
+		"etag":             "ETag",
+		"www-authenticate": "WWW-Authenticate",
+		"te":               "TE",
+		"host":             "Host",
+		"bad name":         "bad name",
+	}
+	for key, canonical := range tests {
+		assert.Equal(t, canonical, CanonicalKey(key), key)
+	}
+}
@@ -20,13 +20,35 @@ const (
 	parserDone
 )
 
+type chunkState int
+
+const (
+	chunkParsingSize chunkState = iota
+	chunkParsingData
+	chunkParsingDataEnd
+	chunkParsingTrailers
+)
+
 const bufferSize = 8
 
 type Request struct {
-	RequestLine RequestLine
-	ParserState parserState
-	Headers     headers.Headers
-	Body        []byte
+	RequestLine    RequestLine
+	URL            *URL
+	ParserState    parserState
+	Headers        *headers.Headers
+	Body           io.ReadCloser
+	Trailers       *headers.Headers
+	Params         map[string]string
+	RawParams      map[string]string
+	config         Config
+	headerBytes    int
+	headerCount    int
+	bodyBuf        []byte
+	bodyRead       int
+	chunked        bool
+	contentLength  int
+	chunkState     chunkState
+	chunkRemaining int
 }
 
 type RequestLine struct {
@@ -35,50 +57,189 @@ type RequestLine struct {
 	Method        string
 }
 
+type Reader struct {
+	reader      io.Reader
+	config      Config
+	buf         []byte
+	readToIndex int
+	undrained   bool
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return NewReaderConfig(reader, DefaultConfig())
+}
+
+func NewReaderConfig(reader io.Reader, config Config) *Reader {
+	return &Reader{
+		reader: reader,
+		config: config,
+		buf:    make([]byte, bufferSize),
+	}
+}
+
+// RequestFromReader reads a single request including its whole body, which
+// is then available from Body or ReadBody without further reads.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	var readToIndex int
-	req := Request{
+	req, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// ReadRequest parses the request line and headers of the next request from
+// the underlying reader. The body is not read up front: it is pulled from the
+// connection as Body is read, and must be consumed or closed before the next
+// call. Bytes read past the end of the request are kept for the following
+// call, so a single Reader can be used for every request sent on a persistent
+// connection.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if rr.undrained {
+		return nil, ErrBodyNotDrained
+	}
+
+	req := &Request{
 		ParserState: parserInitialised,
 		Headers:     headers.NewHeaders(),
-		Body:        make([]byte, 0),
+		Trailers:    headers.NewHeaders(),
+		config:      rr.config,
 	}
 
-	for req.ParserState != parserDone {
-		if readToIndex >= cap(buf) {
-			newBuf := make([]byte, cap(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	for {
+		err := rr.parseBuffered(req)
+		if err != nil {
+			return nil, err
 		}
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if err == io.EOF {
-				if req.ParserState != parserDone {
-					return nil, errors.New("incomplete request")
-				}
-
-				val, _ := req.Headers.Get("content-length")
-				contentLength, _ := strconv.Atoi(val)
-				if len(req.Body) < contentLength {
-					return nil, errors.New("length of parsed body is not equal to content-length")
-				}
-				break
-			}
+		if req.ParserState == parserParsingBody || req.ParserState == parserDone {
+			break
+		}
 
+		err = rr.readMore(req)
+		if err != nil {
 			return nil, err
 		}
-		readToIndex += numBytesRead
-		numBytesConsumed, err := req.parse(buf[:readToIndex])
+	}
+
+	req.Body = &body{reader: rr, req: req}
+	if rr.config.DecodeContentEncoding {
+		err := decodeBody(req)
 		if err != nil {
 			return nil, err
 		}
+	}
+	return req, nil
+}
+
+func (rr *Reader) parseBuffered(req *Request) error {
+	numBytesConsumed, err := req.parse(rr.buf[:rr.readToIndex])
+	if err != nil {
+		return err
+	}
+
+	copy(rr.buf, rr.buf[numBytesConsumed:rr.readToIndex])
+	rr.readToIndex -= numBytesConsumed
+	return nil
+}
+
+func (rr *Reader) readMore(req *Request) error {
+	if rr.readToIndex >= cap(rr.buf) {
+		newBuf := make([]byte, cap(rr.buf)*2)
+		copy(newBuf, rr.buf)
+		rr.buf = newBuf
+	}
+
+	numBytesRead, err := rr.reader.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += numBytesRead
+	if err != nil {
+		if err == io.EOF {
+			if numBytesRead > 0 {
+				return nil
+			}
+			if req.ParserState == parserInitialised && rr.readToIndex == 0 {
+				return io.EOF
+			}
+			return fmt.Errorf("%w: %w", ErrIncompleteRequest, io.ErrUnexpectedEOF)
+		}
+
+		if req.ParserState != parserInitialised || rr.readToIndex > 0 {
+			return fmt.Errorf("%w: %w", ErrIncompleteRequest, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Wait blocks until at least one byte of the next request has been received,
+// which lets callers tell an idle connection apart from one mid-request.
+func (rr *Reader) Wait() error {
+	for rr.readToIndex == 0 {
+		numBytesRead, err := rr.reader.Read(rr.buf)
+		rr.readToIndex += numBytesRead
+		if err != nil && rr.readToIndex == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// Param returns the value of a path parameter captured by the router.
+func (r *Request) Param(name string) string {
+	return r.Params[name]
+}
+
+// RawParam returns a path parameter as it was sent, before percent-decoding.
+// Unlike Param, a wildcard's value keeps encoded slashes apart from the ones
+// separating its segments.
+func (r *Request) RawParam(name string) string {
+	return r.RawParams[name]
+}
+
+// ReadBody reads the rest of the body into memory. Body is replaced with a
+// reader over the returned bytes, so the body can still be read afterwards.
+func (r *Request) ReadBody() ([]byte, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.1 connections persist unless the client sends
+// "Connection: close"; HTTP/1.0 ones only with "Connection: keep-alive", and
+// never after a body framed with Transfer-Encoding, which 1.0 does not define.
+func (r *Request) KeepAlive() bool {
+	value, _ := r.Headers.Get("Connection")
+	keepAlive := !r.IsHTTP10()
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if strings.EqualFold(token, "close") {
+			return false
+		}
+		if strings.EqualFold(token, "keep-alive") {
+			keepAlive = true
+		}
+	}
 
-		copy(buf, buf[numBytesConsumed:])
-		readToIndex -= numBytesConsumed
+	if _, ok := r.Headers.Get("Transfer-Encoding"); ok && r.IsHTTP10() {
+		return false
 	}
+	return keepAlive
+}
 
-	return &req, nil
+// IsHTTP10 reports whether the request was sent as HTTP/1.0.
+func (r *Request) IsHTTP10() bool {
+	return r.RequestLine.HttpVersion == "1.0"
 }
 
 func (r *Request) parse(data []byte) (int, error) {
@@ -101,91 +262,256 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.ParserState {
 	case parserInitialised:
-		requestLine, numBytesConsumed, err := parseRequestLine(data)
+		if r.config.AllowLeadingEmptyLines {
+			lineEnd, next := headers.LineEnd(data, r.config.AllowBareLF)
+			if lineEnd == 0 {
+				return next, nil
+			}
+		}
+
+		requestLine, lineLength, numBytesConsumed, err := parseRequestLine(data, r.config)
 		if err != nil {
 			return 0, err
 		}
 
+		maxLength := r.config.MaxRequestLineLength
 		if numBytesConsumed == 0 {
+			if maxLength > 0 && len(data) > maxLength {
+				return 0, fmt.Errorf("%w: request-line exceeds %d bytes", ErrURITooLong, maxLength)
+			}
 			return 0, nil
 		}
+		if maxLength > 0 && lineLength > maxLength {
+			return 0, fmt.Errorf("%w: request-line exceeds %d bytes", ErrURITooLong, maxLength)
+		}
+
+		u, err := parseRequestTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
 
 		r.RequestLine = *requestLine
+		r.URL = u
 		r.ParserState = parserParsingHeaders
 
 		return numBytesConsumed, nil
 
 	case parserParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.Headers.ParseWith(data, r.config.headerOptions())
+		if err != nil {
+			return 0, err
+		}
+		err = r.checkHeaderLimits(n, done, len(data))
 		if err != nil {
 			return 0, err
 		}
 		if done {
+			err = r.parseFraming()
+			if err != nil {
+				return 0, err
+			}
 			r.ParserState = parserParsingBody
 		}
 		return n, nil
 
 	case parserParsingBody:
-		value, exists := r.Headers.Get("Content-Length")
-		if !exists {
-			r.ParserState = parserDone
-			return len(data), nil
+		return r.parseBody(data)
+
+	case parserDone:
+		return 0, errors.New("error: trying to read data in a done state")
+	default:
+		return 0, errors.New("error: unknown state")
+	}
+}
+
+// checkHeaderLimits accounts for a single Headers.Parse call. Trailers are
+// counted against the same limits as the header section.
+func (r *Request) checkHeaderLimits(n int, done bool, available int) error {
+	maxBytes := r.config.MaxHeaderBytes
+	if n == 0 {
+		if maxBytes > 0 && r.headerBytes+available > maxBytes {
+			return fmt.Errorf("%w: exceeds %d bytes", headers.ErrHeaderTooLarge, maxBytes)
 		}
+		return nil
+	}
 
-		contentLength, err := strconv.Atoi(value)
-		if err != nil {
-			return 0, fmt.Errorf("Malformed Content-Length: %s", err)
+	r.headerBytes += n
+	if maxBytes > 0 && r.headerBytes > maxBytes {
+		return fmt.Errorf("%w: exceeds %d bytes", headers.ErrHeaderTooLarge, maxBytes)
+	}
+
+	if !done {
+		r.headerCount++
+		maxCount := r.config.MaxHeaderCount
+		if maxCount > 0 && r.headerCount > maxCount {
+			return fmt.Errorf("%w: more than %d fields", headers.ErrHeaderTooLarge, maxCount)
 		}
+	}
+	return nil
+}
 
-		if len(data) == 0 && contentLength == 0 {
-			r.ParserState = parserDone
+// parseFraming works out how the body is delimited once the header section
+// is complete, so that later changes to Headers cannot affect parsing.
+func (r *Request) parseFraming() error {
+	transferEncoding, chunked := r.Headers.Get("Transfer-Encoding")
+	value, exists := r.Headers.Get("Content-Length")
+
+	if chunked {
+		if exists {
+			return fmt.Errorf("%w: Transfer-Encoding and Content-Length cannot both be present", ErrMalformedBody)
+		}
+		if !strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked") {
+			return fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, transferEncoding)
+		}
+		r.chunked = true
+		return nil
+	}
+
+	if !exists {
+		return nil
+	}
+
+	// Content-Length is 1*DIGIT; Atoi alone would also take a sign, which
+	// another hop may frame differently
+	for i := 0; i < len(value); i++ {
+		if !isDigit(value[i]) {
+			return fmt.Errorf("%w: Malformed Content-Length: %s", ErrMalformedBody, value)
+		}
+	}
+	contentLength, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%w: Malformed Content-Length: %s", ErrMalformedBody, value)
+	}
+	if r.config.MaxBodySize > 0 && contentLength > r.config.MaxBodySize {
+		return fmt.Errorf("%w: Content-Length %d exceeds %d bytes", ErrBodyTooLarge, contentLength, r.config.MaxBodySize)
+	}
+	r.contentLength = contentLength
+	return nil
+}
+
+func (r *Request) parseBody(data []byte) (int, error) {
+	if r.chunked {
+		return r.parseChunked(data)
+	}
+
+	remaining := r.contentLength - r.bodyRead
+	n := min(remaining, len(data))
+	r.bodyBuf = append(r.bodyBuf, data[:n]...)
+	r.bodyRead += n
+
+	if r.bodyRead == r.contentLength {
+		r.ParserState = parserDone
+	}
+
+	return n, nil
+}
+
+func (r *Request) parseChunked(data []byte) (int, error) {
+	switch r.chunkState {
+	case chunkParsingSize:
+		idx, next := headers.LineEnd(data, r.config.AllowBareLF)
+		if idx == -1 {
+			if len(data) > maxChunkLineLength {
+				return 0, fmt.Errorf("%w: chunk-size line too long", ErrMalformedBody)
+			}
 			return 0, nil
 		}
 
-		r.Body = append(r.Body, data...)
+		// chunk extensions are allowed after the size but carry nothing we use
+		sizeText, _, _ := strings.Cut(string(data[:idx]), ";")
+		size, err := strconv.ParseUint(strings.TrimRight(sizeText, " \t"), 16, 31)
+		if err != nil {
+			return 0, fmt.Errorf("%w: Malformed chunk size: %s", ErrMalformedBody, sizeText)
+		}
 
-		if len(r.Body) > contentLength {
-			return 0, fmt.Errorf("content length (%d) header cannot be greater than body length (%d)", contentLength, len(r.Body))
+		if r.config.MaxBodySize > 0 && r.bodyRead+int(size) > r.config.MaxBodySize {
+			return 0, fmt.Errorf("%w: chunked body exceeds %d bytes", ErrBodyTooLarge, r.config.MaxBodySize)
 		}
 
-		if len(r.Body) == contentLength {
-			r.ParserState = parserDone
+		if size == 0 {
+			r.chunkState = chunkParsingTrailers
+		} else {
+			r.chunkRemaining = int(size)
+			r.chunkState = chunkParsingData
+		}
+		return next, nil
+
+	case chunkParsingData:
+		n := min(r.chunkRemaining, len(data))
+		r.bodyBuf = append(r.bodyBuf, data[:n]...)
+		r.bodyRead += n
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.chunkState = chunkParsingDataEnd
+		}
+		return n, nil
+
+	case chunkParsingDataEnd:
+		if r.config.AllowBareLF && len(data) > 0 && data[0] == '\n' {
+			r.chunkState = chunkParsingSize
+			return 1, nil
+		}
+		if len(data) < 2 {
+			return 0, nil
 		}
+		if !bytes.HasPrefix(data, []byte(headers.CRLF)) {
+			return 0, fmt.Errorf("%w: chunk data not terminated by CRLF", ErrMalformedBody)
+		}
+		r.chunkState = chunkParsingSize
+		return 2, nil
 
-		return len(data), nil
+	case chunkParsingTrailers:
+		n, done, err := r.Trailers.ParseWith(data, r.config.headerOptions())
+		if err != nil {
+			return 0, err
+		}
+		err = r.checkHeaderLimits(n, done, len(data))
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			r.ParserState = parserDone
+		}
+		return n, nil
 
-	case parserDone:
-		return 0, errors.New("error: trying to read data in a done state")
 	default:
-		return 0, errors.New("error: unknown state")
+		return 0, errors.New("error: unknown chunk state")
 	}
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
-	idx := bytes.Index(data, []byte("\r\n"))
-	if idx == -1 {
-		return nil, 0, nil
+// parseRequestLine returns the request line, its length without the line
+// ending and the number of bytes consumed, which is 0 until a whole line has
+// been received.
+func parseRequestLine(data []byte, config Config) (*RequestLine, int, int, error) {
+	lineEnd, next := headers.LineEnd(data, config.AllowBareLF)
+	if lineEnd == -1 {
+		return nil, 0, 0, nil
 	}
 
-	requestLineText := string(data[:idx])
-	requestLine, err := requestLineFromString(requestLineText)
+	requestLineText := string(data[:lineEnd])
+	requestLine, err := requestLineFromString(requestLineText, config.AllowExtraWhitespace)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 
-	return requestLine, idx + 2, nil
+	return requestLine, lineEnd, next, nil
 }
 
-func requestLineFromString(str string) (*RequestLine, error) {
+func requestLineFromString(str string, allowExtraWhitespace bool) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
+	if allowExtraWhitespace {
+		parts = strings.FieldsFunc(str, func(c rune) bool {
+			return c == ' ' || c == '\t' || c == '\v' || c == '\f' || c == '\r'
+		})
+	}
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
 	}
 
 	method := parts[0]
 	for _, c := range method {
 		if c < 'A' || c > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMethod, method)
 		}
 	}
 
@@ -193,17 +519,20 @@ func requestLineFromString(str string) (*RequestLine, error) {
 
 	versionParts := strings.Split(parts[2], "/")
 	if len(versionParts) != 2 {
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
 	}
 
 	httpPart := versionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("Unrecognised HTTP-version: %s", httpPart)
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
 	}
 
 	httpVersion := versionParts[1]
-	if httpVersion != "1.1" {
-		return nil, fmt.Errorf("Unrecognised HTTP-version: %s", httpVersion)
+	if len(httpVersion) != 3 || !isDigit(httpVersion[0]) || httpVersion[1] != '.' || !isDigit(httpVersion[2]) {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
+	}
+	if httpVersion != "1.0" && httpVersion != "1.1" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, httpVersion)
 	}
 
 	return &RequestLine{
@@ -212,3 +541,7 @@ func requestLineFromString(str string) (*RequestLine, error) {
 		Method:        method,
 	}, nil
 }
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
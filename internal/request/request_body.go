@@ -0,0 +1,64 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+// maxDrainSize is how much of an unread body Close discards to keep the
+// connection usable. Past it, reading on is not worth it and the connection
+// should be closed instead.
+const maxDrainSize = 256 << 10
+
+type body struct {
+	reader *Reader
+	req    *Request
+	closed bool
+}
+
+// Read hands out decoded body bytes, reading from the connection only when
+// the already parsed bytes have been consumed. Trailers of a chunked body are
+// available once Read has returned io.EOF.
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+
+	for len(b.req.bodyBuf) == 0 {
+		if b.req.ParserState == parserDone {
+			return 0, io.EOF
+		}
+
+		err := b.reader.readMore(b.req)
+		if err != nil {
+			return 0, err
+		}
+
+		err = b.reader.parseBuffered(b.req)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, b.req.bodyBuf)
+	b.req.bodyBuf = b.req.bodyBuf[n:]
+	return n, nil
+}
+
+// Close discards whatever is left of the body so the next request on the
+// connection can be parsed. If more than maxDrainSize bytes are left it stops
+// and returns ErrBodyNotDrained, after which the Reader refuses to read
+// further requests.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(b, maxDrainSize+1))
+	b.closed = true
+	if err == nil && n > maxDrainSize {
+		b.reader.undrained = true
+		return ErrBodyNotDrained
+	}
+	return err
+}
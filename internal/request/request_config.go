@@ -0,0 +1,66 @@
+package request
+
+import "github.com/delroscol98/httpfromtcp/internal/headers"
+
+// Config bounds how much of a request the parser will accept. A zero value
+// for any field disables that limit.
+type Config struct {
+	MaxRequestLineLength int
+	MaxHeaderBytes       int
+	MaxHeaderCount       int
+	MaxBodySize          int
+
+	// DecodeContentEncoding makes Body return the decompressed content of
+	// gzip and deflate encoded requests. Any other Content-Encoding is
+	// rejected with ErrUnsupportedContentEncoding.
+	DecodeContentEncoding bool
+	// MaxDecodedBodySize caps the decompressed body, which can be far
+	// larger than MaxBodySize allows on the wire.
+	MaxDecodedBodySize int
+
+	// The fields below relax RFC 9112 parsing for clients that do not
+	// follow it. They are all off by default; LenientConfig enables them.
+
+	// AllowBareLF accepts LF without CR as a line ending anywhere CRLF is
+	// expected: the request line, field lines, chunk lines and trailers.
+	AllowBareLF bool
+	// AllowObsFold accepts obsolete line folding in header and trailer
+	// values, replacing each fold with a single space.
+	AllowObsFold bool
+	// AllowExtraWhitespace splits the request line on any run of spaces,
+	// tabs, vertical tabs, form feeds and bare CRs instead of exactly one
+	// space, and ignores whitespace around it.
+	AllowExtraWhitespace bool
+	// AllowLeadingEmptyLines skips empty lines received before the request
+	// line, such as the stray CRLF some clients send after a request body.
+	AllowLeadingEmptyLines bool
+}
+
+// maxChunkLineLength caps a chunk-size line including any chunk extensions.
+const maxChunkLineLength = 4096
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRequestLineLength: 8 << 10,
+		MaxHeaderBytes:       1 << 20,
+		MaxHeaderCount:       100,
+		MaxDecodedBodySize:   10 << 20,
+	}
+}
+
+// LenientConfig is DefaultConfig with every parsing leniency enabled.
+func LenientConfig() Config {
+	config := DefaultConfig()
+	config.AllowBareLF = true
+	config.AllowObsFold = true
+	config.AllowExtraWhitespace = true
+	config.AllowLeadingEmptyLines = true
+	return config
+}
+
+func (c Config) headerOptions() headers.ParseOptions {
+	return headers.ParseOptions{
+		AllowBareLF:  c.AllowBareLF,
+		AllowObsFold: c.AllowObsFold,
+	}
+}
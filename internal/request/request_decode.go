@@ -0,0 +1,155 @@
+package request
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodedBody decompresses a body sent with a Content-Encoding. The decoders
+// are only created on the first Read, since they read the stream's header.
+type decodedBody struct {
+	raw     io.ReadCloser
+	codings []string
+	decoder io.Reader
+	closers []io.Closer
+	limit   int
+	read    int
+	err     error
+	closed  bool
+}
+
+// decodeBody replaces req.Body with one that undoes the codings listed in
+// Content-Encoding. The header, and Content-Length which no longer describes
+// the body, are removed.
+func decodeBody(req *Request) error {
+	value, ok := req.Headers.Get("Content-Encoding")
+	if !ok {
+		return nil
+	}
+
+	var codings []string
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+			continue
+		case "x-gzip":
+			coding = "gzip"
+		case "gzip", "deflate":
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding)
+		}
+		codings = append(codings, coding)
+	}
+
+	req.Headers.Del("Content-Encoding")
+	if len(codings) == 0 {
+		return nil
+	}
+
+	req.Headers.Del("Content-Length")
+	req.Body = &decodedBody{
+		raw:     req.Body,
+		codings: codings,
+		limit:   req.config.MaxDecodedBodySize,
+	}
+	return nil
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	if b.decoder == nil {
+		b.err = b.init()
+		if b.err != nil {
+			return 0, b.err
+		}
+	}
+
+	if b.limit > 0 && len(p) > b.limit-b.read+1 {
+		// read one byte past the limit to tell a body of exactly the
+		// limit from a longer one
+		p = p[:b.limit-b.read+1]
+	}
+
+	n, err := b.decoder.Read(p)
+	b.read += n
+	if b.limit > 0 && b.read > b.limit {
+		b.err = fmt.Errorf("%w: decoded body exceeds %d bytes", ErrBodyTooLarge, b.limit)
+		return n - (b.read - b.limit), b.err
+	}
+	if err != nil && err != io.EOF {
+		if !errors.Is(err, ErrIncompleteRequest) && !errors.Is(err, ErrBodyTooLarge) && !errors.Is(err, ErrMalformedBody) {
+			err = fmt.Errorf("%w: %w", ErrMalformedBody, err)
+		}
+		b.err = err
+	}
+	return n, err
+}
+
+// init stacks the decoders, undoing the last applied coding first.
+func (b *decodedBody) init() error {
+	var r io.Reader = b.raw
+	for i := len(b.codings) - 1; i >= 0; i-- {
+		var decoder io.ReadCloser
+		var err error
+		switch b.codings[i] {
+		case "gzip":
+			decoder, err = gzip.NewReader(r)
+		case "deflate":
+			decoder, err = newDeflateReader(r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("%w: %s: %w", ErrMalformedBody, b.codings[i], err)
+		}
+
+		b.closers = append(b.closers, decoder)
+		r = decoder
+	}
+
+	b.decoder = r
+	return nil
+}
+
+// newDeflateReader accepts the zlib format that "deflate" names as well as
+// the raw deflate stream some clients send instead.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// Close releases the decoders and discards the rest of the raw body so the
+// next request on the connection can be parsed.
+func (b *decodedBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for _, closer := range b.closers {
+		closer.Close()
+	}
+	return b.raw.Close()
+}
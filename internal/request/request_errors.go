@@ -0,0 +1,19 @@
+package request
+
+import "errors"
+
+// Parse errors are wrapped with the offending input, so callers should match
+// them with errors.Is.
+var (
+	ErrMalformedRequestLine        = errors.New("poorly formatted request-line")
+	ErrInvalidMethod               = errors.New("invalid method")
+	ErrUnsupportedVersion          = errors.New("Unrecognised HTTP-version")
+	ErrInvalidTarget               = errors.New("invalid request-target")
+	ErrURITooLong                  = errors.New("request-target too long")
+	ErrMalformedBody               = errors.New("malformed message body")
+	ErrBodyTooLarge                = errors.New("body too large")
+	ErrUnsupportedTransferEncoding = errors.New("Unsupported Transfer-Encoding")
+	ErrUnsupportedContentEncoding  = errors.New("unsupported Content-Encoding")
+	ErrIncompleteRequest           = errors.New("incomplete request")
+	ErrBodyNotDrained              = errors.New("unread request body too large to discard")
+)
@@ -1,8 +1,13 @@
 package request
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"io"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/delroscol98/httpfromtcp/internal/headers"
@@ -109,9 +114,9 @@ func TestRequestWithHeaders(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, []string{"localhost:42069"}, r.Headers.Values("host"))
+	assert.Equal(t, []string{"curl/7.81.0"}, r.Headers.Values("user-agent"))
+	assert.Equal(t, []string{"*/*"}, r.Headers.Values("accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
@@ -139,7 +144,7 @@ func TestRequestWithHeaders(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", r.Headers["set-person"])
+	assert.Equal(t, []string{"lane-loves-go", "prime-loves-zig", "tj-loves-ocaml"}, r.Headers.Values("set-person"))
 
 	// Test: Case insensitive headers
 	reader = &chunkReader{
@@ -149,7 +154,7 @@ func TestRequestWithHeaders(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "person-1, person-2", r.Headers["authorization"])
+	assert.Equal(t, []string{"person-1", "person-2"}, r.Headers.Values("authorization"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -173,8 +178,10 @@ func TestWithBody(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
-	assert.Equal(t, strconv.Itoa(len(r.Body)), r.Headers["content-length"])
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, []string{strconv.Itoa(len(body))}, r.Headers.Values("content-length"))
 
 	// Test: Valid Empty Body, 0 reported in content length
 	reader = &chunkReader{
@@ -187,7 +194,9 @@ func TestWithBody(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, strconv.Itoa(len(r.Body)), r.Headers["content-length"])
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, []string{strconv.Itoa(len(body))}, r.Headers.Values("content-length"))
 
 	// Test: Valid Empty Body, no reported content length
 	reader = &chunkReader{
@@ -224,3 +233,558 @@ func TestWithBody(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestPersistentConnection(t *testing.T) {
+	// Test: Two pipelined requests read from the same reader
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean EOF between requests
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Whole second request already buffered after the first read
+	data := "GET /a HTTP/1.1\r\n\r\nGET /b HTTP/1.1\r\n\r\n"
+	reader = NewReader(&chunkReader{
+		data:            data,
+		numBytesPerRead: len(data),
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/a", r.RequestLine.RequestTarget)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/b", r.RequestLine.RequestTarget)
+
+	// Test: Close drains a small unread body
+	data = "POST /a HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET /b HTTP/1.1\r\n\r\n"
+	reader = NewReader(strings.NewReader(data))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/b", r.RequestLine.RequestTarget)
+
+	// Test: Close gives up on a large unread body and the reader stops
+	size := maxDrainSize + 1024
+	data = "POST /a HTTP/1.1\r\nContent-Length: " + strconv.Itoa(size) + "\r\n\r\n" + strings.Repeat("x", size) + "GET /b HTTP/1.1\r\n\r\n"
+	reader = NewReader(strings.NewReader(data))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.Body.Close(), ErrBodyNotDrained)
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrBodyNotDrained)
+}
+
+func TestChunkedBody(t *testing.T) {
+	// Test: Valid chunked body with extension and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"a;name=value\r\nworld!!!!\n\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!!!!\n", string(body))
+	assert.Equal(t, []string{"abc123"}, r.Trailers.Values("x-checksum"))
+
+	// Test: Chunked body without trailers followed by another request
+	rr := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Unsupported transfer coding
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: gzip\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Body is read lazily after the headers are parsed
+	src := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"abcdefghijklmnopqrstuvwxyz",
+		numBytesPerRead: 4,
+	}
+	r, err := NewReader(src).ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Less(t, src.pos, len(src.data))
+
+	p := make([]byte, 5)
+	n, err := r.Body.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "abcde"[:n], string(p[:n]))
+
+	rest, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(p[:n])+string(rest))
+	require.NoError(t, r.Body.Close())
+
+	// Test: Closing an unread body skips to the next request
+	rr := NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Body cut short reports an unexpected EOF
+	r, err = NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial",
+		numBytesPerRead: 3,
+	}).ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRequestTarget(t *testing.T) {
+	parse := func(method, target string) (*Request, error) {
+		return RequestFromReader(&chunkReader{
+			data:            method + " " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 7,
+		})
+	}
+
+	// Test: Origin-form with query and percent-encoding
+	r, err := parse("GET", "/search/hello%20world?q=go+lang&page=2&page=3")
+	require.NoError(t, err)
+	assert.Equal(t, OriginForm, r.URL.Form)
+	assert.Equal(t, "/search/hello world", r.URL.Path)
+	assert.Equal(t, "/search/hello%20world", r.URL.RawPath)
+	assert.Equal(t, "q=go+lang&page=2&page=3", r.URL.RawQuery)
+	assert.Equal(t, "go lang", r.URL.Query.Get("q"))
+	assert.Equal(t, []string{"2", "3"}, r.URL.Query["page"])
+
+	// Test: Dot-segments are removed and never climb above the root
+	r, err = parse("GET", "/a/b/../c/./d")
+	require.NoError(t, err)
+	assert.Equal(t, "/a/c/d", r.URL.Path)
+	r, err = parse("GET", "/../../etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/passwd", r.URL.Path)
+	r, err = parse("GET", "/a/%2e%2e/b/")
+	require.NoError(t, err)
+	assert.Equal(t, "/b/", r.URL.Path)
+	assert.Equal(t, []string{"b", ""}, r.URL.Segments())
+
+	// Test: Segments are decoded after splitting
+	r, err = parse("GET", "/users/a%2Fb/../c%20d")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "c d"}, r.URL.Segments())
+	r, err = parse("GET", "/users/a%2Fb")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "a/b"}, r.URL.Segments())
+	assert.Equal(t, []string{"users", "a%2Fb"}, r.URL.RawSegments())
+	r, err = parse("GET", "/users/a%2Fb/%2e%2e/c%20d/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "c%20d", ""}, r.URL.RawSegments())
+
+	// Test: Absolute-form
+	r, err = parse("GET", "http://example.com:8080/path?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, AbsoluteForm, r.URL.Form)
+	assert.Equal(t, "http", r.URL.Scheme)
+	assert.Equal(t, "example.com:8080", r.URL.Host)
+	assert.Equal(t, "/path", r.URL.Path)
+	assert.Equal(t, "1", r.URL.Query.Get("x"))
+
+	// Test: Authority-form
+	r, err = parse("CONNECT", "example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, AuthorityForm, r.URL.Form)
+	assert.Equal(t, "example.com:443", r.URL.Host)
+
+	// Test: Asterisk-form
+	r, err = parse("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, AsteriskForm, r.URL.Form)
+
+	// Test: Invalid targets
+	for _, tc := range [][2]string{
+		{"GET", "/page#section"},
+		{"GET", "/bad%zzescape"},
+		{"GET", "/q?a=%zz"},
+		{"GET", "*"},
+		{"GET", "example.com"},
+		{"GET", "ftp://example.com/file"},
+		{"CONNECT", "/path"},
+	} {
+		_, err = parse(tc[0], tc[1])
+		assert.Error(t, err, tc[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		err  error
+	}{
+		{"GET / HTTP/2.0\r\n\r\n", ErrUnsupportedVersion},
+		{"GET / HTTP/0.9\r\n\r\n", ErrUnsupportedVersion},
+		{"GET / HTTP/1.x\r\n\r\n", ErrMalformedRequestLine},
+		{"GET / HTTP/11\r\n\r\n", ErrMalformedRequestLine},
+		{"GET / HTTX/1.1\r\n\r\n", ErrMalformedRequestLine},
+		{"GET /  HTTP/1.1\r\n\r\n", ErrMalformedRequestLine},
+		{"get / HTTP/1.1\r\n\r\n", ErrInvalidMethod},
+		{"GET /#frag HTTP/1.1\r\n\r\n", ErrInvalidTarget},
+		{"GET / HTTP/1.1\r\nHost localhost\r\n\r\n", headers.ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n", headers.ErrInvalidKey},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", ErrUnsupportedTransferEncoding},
+		{"POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n", ErrMalformedBody},
+		{"POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello", ErrMalformedBody},
+		{"POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", ErrMalformedBody},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n", ErrMalformedBody},
+		{"POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nabc", ErrIncompleteRequest},
+	} {
+		_, err := RequestFromReader(&chunkReader{
+			data:            tc.data,
+			numBytesPerRead: 4,
+		})
+		assert.ErrorIs(t, err, tc.err, tc.data)
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	config := Config{
+		MaxRequestLineLength: 32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       3,
+		MaxBodySize:          10,
+	}
+	read := func(data string) error {
+		r, err := NewReaderConfig(&chunkReader{
+			data:            data,
+			numBytesPerRead: 5,
+		}, config).ReadRequest()
+		if err != nil {
+			return err
+		}
+		_, err = r.ReadBody()
+		return err
+	}
+
+	// Test: Within every limit
+	err := read("POST /ok HTTP/1.1\r\nHost: a\r\nContent-Length: 10\r\n\r\n0123456789")
+	require.NoError(t, err)
+
+	// Test: Request-line too long, with and without a terminating CRLF
+	err = read("GET /" + strings.Repeat("a", 40) + " HTTP/1.1\r\n\r\n")
+	assert.ErrorIs(t, err, ErrURITooLong)
+	err = read("GET /" + strings.Repeat("a", 100))
+	assert.ErrorIs(t, err, ErrURITooLong)
+
+	// Test: Header section too large
+	err = read("GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("b", 80) + "\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrHeaderTooLarge)
+
+	// Test: Too many header fields
+	err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrHeaderTooLarge)
+
+	// Test: Content-Length above the limit is rejected before reading the body
+	_, err = NewReaderConfig(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\n"), config).ReadRequest()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body above the limit
+	err = read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n")
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Zero values disable the limits
+	config = Config{}
+	err = read("GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\nX-Big: " + strings.Repeat("b", 100) + "\r\n\r\n")
+	require.NoError(t, err)
+}
+
+func compress(t *testing.T, coding, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	_, err := io.WriteString(w, data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestContentEncoding(t *testing.T) {
+	config := DefaultConfig()
+	config.DecodeContentEncoding = true
+	config.MaxDecodedBodySize = 100
+	read := func(encoding, body string) (*Request, []byte, error) {
+		data := "POST /upload HTTP/1.1\r\nContent-Encoding: " + encoding + "\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+		r, err := NewReaderConfig(&chunkReader{
+			data:            data,
+			numBytesPerRead: 7,
+		}, config).ReadRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+		decoded, err := r.ReadBody()
+		return r, decoded, err
+	}
+
+	// Test: gzip body is decoded and the headers updated
+	r, decoded, err := read("gzip", compress(t, "gzip", "hello gzip"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello gzip", string(decoded))
+	_, ok := r.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	_, ok = r.Headers.Get("Content-Length")
+	assert.False(t, ok)
+
+	// Test: deflate accepts zlib and raw streams
+	_, decoded, err = read("deflate", compress(t, "deflate", "hello zlib"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello zlib", string(decoded))
+	_, decoded, err = read("deflate", compress(t, "raw-deflate", "hello flate"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello flate", string(decoded))
+
+	// Test: Stacked codings are undone in reverse order
+	_, decoded, err = read("deflate, gzip", compress(t, "gzip", compress(t, "deflate", "twice")))
+	require.NoError(t, err)
+	assert.Equal(t, "twice", string(decoded))
+
+	// Test: identity leaves the body alone
+	r, decoded, err = read("identity", "plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(decoded))
+	assert.Equal(t, []string{"5"}, r.Headers.Values("content-length"))
+
+	// Test: Decompression bomb is cut off at the limit
+	_, decoded, err = read("gzip", compress(t, "gzip", strings.Repeat("a", 100)))
+	require.NoError(t, err)
+	assert.Len(t, decoded, 100)
+	_, decoded, err = read("gzip", compress(t, "gzip", strings.Repeat("a", 1<<20)))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Len(t, decoded, 0)
+
+	// Test: Corrupt and unknown encodings
+	_, _, err = read("gzip", "not gzip at all")
+	assert.ErrorIs(t, err, ErrMalformedBody)
+	_, _, err = read("gzip", compress(t, "gzip", "truncated")[:15])
+	assert.ErrorIs(t, err, ErrMalformedBody)
+	_, _, err = read("br", "data")
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+
+	// Test: Decoding is off by default
+	r, err = NewReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Encoding: br\r\nContent-Length: 4\r\n\r\ndata")).ReadRequest()
+	require.NoError(t, err)
+	decoded, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(decoded))
+}
+
+func TestLenientParsing(t *testing.T) {
+	parse := func(config Config, data string) (*Request, error) {
+		r, err := NewReaderConfig(&chunkReader{
+			data:            data,
+			numBytesPerRead: 3,
+		}, config).ReadRequest()
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	tests := []struct {
+		name   string
+		config func(c *Config)
+		data   string
+	}{
+		{"bare LF", func(c *Config) { c.AllowBareLF = true },
+			"POST /submit HTTP/1.1\nHost: localhost\nTransfer-Encoding: chunked\n\n3\nabc\n0\nX-Sum: 1\n\n"},
+		{"obs-fold", func(c *Config) { c.AllowObsFold = true },
+			"GET /submit HTTP/1.1\r\nHost: localhost\r\nX-Long: first\r\n  second\r\n\tthird\r\n\r\n"},
+		{"extra whitespace", func(c *Config) { c.AllowExtraWhitespace = true },
+			"  GET \t /submit   HTTP/1.1 \r\nHost: localhost\r\n\r\n"},
+		{"leading empty lines", func(c *Config) { c.AllowLeadingEmptyLines = true },
+			"\r\n\r\nGET /submit HTTP/1.1\r\nHost: localhost\r\n\r\n"},
+	}
+	for _, tc := range tests {
+		// Test: Strict parsing rejects the request
+		_, err := parse(DefaultConfig(), tc.data)
+		assert.Error(t, err, tc.name)
+
+		// Test: The matching leniency alone accepts it
+		config := DefaultConfig()
+		tc.config(&config)
+		r, err := parse(config, tc.data)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, "/submit", r.RequestLine.RequestTarget, tc.name)
+		assert.Equal(t, []string{"localhost"}, r.Headers.Values("host"), tc.name)
+	}
+
+	// Test: Lenient results
+	r, err := parse(LenientConfig(), "POST /submit HTTP/1.1\nTransfer-Encoding: chunked\n\n3\nabc\n0\nX-Sum: 1\n\n")
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(body))
+	assert.Equal(t, []string{"1"}, r.Trailers.Values("x-sum"))
+
+	r, err = parse(LenientConfig(), "GET / HTTP/1.1\r\nX-Long: first\r\n  second\r\n\tthird\r\nX-Empty:\r\n folded\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first second third"}, r.Headers.Values("x-long"))
+	assert.Equal(t, []string{"folded"}, r.Headers.Values("x-empty"))
+
+	// Test: Leniency does not extend to bare CR or whitespace before the colon
+	_, err = parse(LenientConfig(), "GET / HTTP/1.1\r\nHost: a\rb\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrInvalidValue)
+	_, err = parse(LenientConfig(), "GET / HTTP/1.1\r\nHost : a\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrMalformedHeader)
+
+	// Test: Empty lines between pipelined requests
+	reader := NewReaderConfig(strings.NewReader("GET /a HTTP/1.1\r\n\r\n\r\nGET /b HTTP/1.1\r\n\r\n\r\n"), LenientConfig())
+	for _, target := range []string{"/a", "/b"} {
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, target, r.RequestLine.RequestTarget)
+		require.NoError(t, r.Body.Close())
+	}
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHTTP10(t *testing.T) {
+	parse := func(data string) *Request {
+		r, err := RequestFromReader(strings.NewReader(data))
+		require.NoError(t, err)
+		return r
+	}
+
+	// Test: HTTP/1.0 is accepted and closes by default
+	r := parse("GET /index.html HTTP/1.0\r\n\r\n")
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.True(t, r.IsHTTP10())
+	assert.False(t, r.KeepAlive())
+
+	// Test: Keep-alive is opt-in for HTTP/1.0
+	r = parse("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n")
+	assert.True(t, r.KeepAlive())
+	r = parse("GET / HTTP/1.0\r\nConnection: keep-alive, close\r\n\r\n")
+	assert.False(t, r.KeepAlive())
+	r = parse("POST / HTTP/1.0\r\nConnection: keep-alive\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 persists unless closed
+	r = parse("GET / HTTP/1.1\r\n\r\n")
+	assert.False(t, r.IsHTTP10())
+	assert.True(t, r.KeepAlive())
+}
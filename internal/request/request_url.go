@@ -0,0 +1,168 @@
+package request
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+type TargetForm int
+
+const (
+	OriginForm TargetForm = iota
+	AbsoluteForm
+	AuthorityForm
+	AsteriskForm
+)
+
+// URL is the parsed request-target. Path is percent-decoded with dot-segments
+// removed, while RawPath keeps the path exactly as it was sent.
+type URL struct {
+	Form     TargetForm
+	Scheme   string
+	Host     string
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    url.Values
+}
+
+func parseRequestTarget(method, target string) (*URL, error) {
+	if target == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidTarget)
+	}
+	for _, c := range []byte(target) {
+		if c <= ' ' || c == 0x7f {
+			return nil, fmt.Errorf("%w: invalid character: %q", ErrInvalidTarget, target)
+		}
+	}
+	if strings.Contains(target, "#") {
+		return nil, fmt.Errorf("%w: fragment not allowed: %s", ErrInvalidTarget, target)
+	}
+
+	if method == "CONNECT" {
+		_, _, err := net.SplitHostPort(target)
+		if err != nil || strings.ContainsAny(target, "/?@") {
+			return nil, fmt.Errorf("%w: CONNECT requires authority-form: %s", ErrInvalidTarget, target)
+		}
+		return &URL{Form: AuthorityForm, Host: target, Query: url.Values{}}, nil
+	}
+
+	if target == "*" {
+		if method != "OPTIONS" {
+			return nil, fmt.Errorf("%w: asterisk-form only allowed for OPTIONS", ErrInvalidTarget)
+		}
+		return &URL{Form: AsteriskForm, Path: "*", RawPath: "*", Query: url.Values{}}, nil
+	}
+
+	u := &URL{Form: OriginForm}
+	if !strings.HasPrefix(target, "/") {
+		scheme, rest, found := strings.Cut(target, "://")
+		scheme = strings.ToLower(scheme)
+		if !found || (scheme != "http" && scheme != "https") {
+			return nil, fmt.Errorf("%w: unsupported: %s", ErrInvalidTarget, target)
+		}
+
+		end := strings.IndexAny(rest, "/?")
+		if end == -1 {
+			end = len(rest)
+		}
+		host := rest[:end]
+		if host == "" || strings.Contains(host, "@") {
+			return nil, fmt.Errorf("%w: invalid authority: %s", ErrInvalidTarget, target)
+		}
+
+		u.Form = AbsoluteForm
+		u.Scheme = scheme
+		u.Host = host
+		target = rest[end:]
+		if !strings.HasPrefix(target, "/") {
+			target = "/" + target
+		}
+	}
+
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	segments := strings.Split(rawPath[1:], "/")
+	for i, seg := range segments {
+		decoded, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid escape in path: %s", ErrInvalidTarget, rawPath)
+		}
+		segments[i] = decoded
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid query: %s", ErrInvalidTarget, rawQuery)
+	}
+
+	u.Path = "/" + strings.Join(removeDotSegments(segments), "/")
+	u.RawPath = rawPath
+	u.RawQuery = rawQuery
+	u.Query = query
+	return u, nil
+}
+
+// Segments returns the path split at its slashes with dot-segments removed.
+// Each segment is percent-decoded after splitting, so an encoded slash such
+// as the one in /users/a%2Fb stays inside its segment.
+func (u *URL) Segments() []string {
+	segments := decodeSegments(u.splitRawPath())
+	return resolveDotSegments(segments, segments)
+}
+
+// RawSegments returns the same segments as Segments, still percent-encoded as
+// they were sent.
+func (u *URL) RawSegments() []string {
+	raw := u.splitRawPath()
+	return resolveDotSegments(decodeSegments(raw), raw)
+}
+
+func (u *URL) splitRawPath() []string {
+	return strings.Split(strings.TrimPrefix(u.RawPath, "/"), "/")
+}
+
+// decodeSegments percent-decodes each segment, keeping any it cannot decode.
+func decodeSegments(raw []string) []string {
+	decoded := make([]string, len(raw))
+	for i, seg := range raw {
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil {
+			unescaped = seg
+		}
+		decoded[i] = unescaped
+	}
+	return decoded
+}
+
+// removeDotSegments resolves "." and ".." path segments as described in
+// RFC 3986 section 5.2.4, never climbing above the root.
+func removeDotSegments(segments []string) []string {
+	return resolveDotSegments(segments, segments)
+}
+
+// resolveDotSegments removes the dot-segments found in decoded from segments,
+// which holds the same path in another form.
+func resolveDotSegments(decoded, segments []string) []string {
+	out := make([]string, 0, len(segments))
+	for i, seg := range decoded {
+		last := i == len(decoded)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segments[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/delroscol98/httpfromtcp/internal/headers"
+)
+
+// bufferedBodySize is how much of the body Write holds back before the
+// headers are sent. A body that fits is sent with a Content-Length, anything
+// larger is sent chunked, or close-delimited to an HTTP/1.0 client.
+const bufferedBodySize = 4096
+
+var _ io.Writer = (*Writer)(nil)
+
+// Header returns the headers sent with the first Write, Flush or Finish. It
+// has no effect once the response has started.
+func (w *Writer) Header() *headers.Headers {
+	if w.header == nil {
+		w.header = headers.NewHeaders()
+	}
+	return w.header
+}
+
+// SetStatus sets the status code sent with the first Write, Flush or Finish.
+// Without it the response is a 200.
+func (w *Writer) SetStatus(statusCode StatusCode) {
+	w.buffered = true
+	w.pendingStatus = statusCode
+}
+
+// Write sends body bytes without the caller having to write the status line
+// and headers first. The first bytes are buffered so that small bodies go out
+// with a Content-Length; once the buffer fills, or on Flush, the headers are
+// sent and the rest of the body is chunked unless the handler set its own
+// Content-Length.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buffered = true
+	if w.State == WritingStatusLine {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < bufferedBodySize {
+			return len(p), nil
+		}
+
+		err := w.commit(false)
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	err := w.writeBuffered(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush sends the headers, if they have not gone out yet, and any buffered
+// body bytes.
+func (w *Writer) Flush() error {
+	w.buffered = true
+	if w.State == WritingStatusLine {
+		return w.commit(false)
+	}
+	if w.encoder != nil && w.State == WritingBody {
+		return w.encoder.Flush()
+	}
+	return nil
+}
+
+// Finish completes a response started with Write, Flush or SetStatus. It is
+// called by the server once the handler returns and does nothing for
+// responses written with WriteStatusLine, WriteHeaders and WriteBody.
+func (w *Writer) Finish() error {
+	if !w.buffered {
+		return nil
+	}
+
+	if w.State == WritingStatusLine {
+		err := w.commit(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.State != WritingBody {
+		return nil
+	}
+
+	if w.encoder != nil {
+		err := w.encoder.Close()
+		w.encoder = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.chunked {
+		return w.WriteChunkedBodyDone()
+	}
+
+	if w.contentLength >= 0 && w.bodyWritten < w.contentLength && !w.discardBody {
+		w.closeConnection = true
+	}
+	w.State = WritingDone
+	return nil
+}
+
+// commit writes the status line and headers and then the buffered body. When
+// final is true the whole body is buffered and its length is known.
+func (w *Writer) commit(final bool) error {
+	statusCode := w.pendingStatus
+	if statusCode == 0 {
+		statusCode = StatusOK
+	}
+
+	h := w.Header()
+	compress := w.compression != nil && w.startCompression(h, statusCode, final)
+	_, hasLength := h.Get("Content-Length")
+	_, hasEncoding := h.Get("Transfer-Encoding")
+	if bodyAllowed(statusCode) && !hasLength && !hasEncoding {
+		if final {
+			h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+		} else {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+	}
+
+	// validate before the status line so a bad field leaves the response
+	// unstarted and an error response can still be sent
+	err := h.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	if compress && w.chunked {
+		w.encoder, err = w.newEncoder()
+		if err != nil {
+			return err
+		}
+	}
+
+	body := w.buf
+	w.buf = nil
+	if len(body) == 0 {
+		return nil
+	}
+	return w.writeBuffered(body)
+}
+
+func (w *Writer) writeBuffered(p []byte) error {
+	if w.State == WritingDone && !bodyAllowed(w.statusCode) {
+		if len(p) > 0 {
+			return fmt.Errorf("status %d does not allow a body", w.statusCode)
+		}
+		return nil
+	}
+
+	if w.State != WritingBody {
+		return errors.New("Writer state needs to be updated for writing body")
+	}
+
+	if w.encoder != nil {
+		_, err := w.encoder.Write(p)
+		return err
+	}
+
+	if w.chunked {
+		_, err := w.WriteChunkedBody(p)
+		return err
+	}
+
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return fmt.Errorf("body exceeds Content-Length of %d bytes", w.contentLength)
+	}
+
+	n, err := w.writeBody(p)
+	w.bodyWritten += n
+	w.countBody(n)
+	if err != nil {
+		return fmt.Errorf("Error writing body: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package response
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/delroscol98/httpfromtcp/internal/headers"
+)
+
+type CompressOptions struct {
+	// MinSize is the smallest body worth compressing. Bodies known to be
+	// shorter, from their Content-Length or because they fit in the write
+	// buffer, are sent as is.
+	MinSize int
+	// Level is a compress/flate level. The zero value selects the default
+	// level rather than no compression.
+	Level int
+}
+
+// incompressibleTypes are media types whose formats are already compressed.
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/zstd", "application/x-bzip2", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/pdf",
+	"font/woff", "font/woff2",
+}
+
+type bodyEncoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type compression struct {
+	encoding string
+	opts     CompressOptions
+}
+
+// chunkWriter feeds an encoder's output to the connection as chunks.
+type chunkWriter struct {
+	w *Writer
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	return c.w.WriteChunkedBody(p)
+}
+
+// Compress makes the buffered io.Writer mode compress the body with gzip or
+// deflate, whichever acceptEncoding prefers. The decision is taken when the
+// headers are sent: responses with a Content-Encoding or Content-Range, media
+// that is already compressed and bodies under opts.MinSize are left alone.
+// A compressed body is always chunked, or close-delimited for HTTP/1.0
+// clients, and a strong ETag is made weak, since the bytes no longer match
+// the identity representation.
+func (w *Writer) Compress(acceptEncoding string, opts CompressOptions) {
+	w.compression = &compression{
+		encoding: negotiateEncoding(acceptEncoding),
+		opts:     opts,
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding value by
+// q-value, preferring gzip on a tie. It returns "" if neither is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qValues := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		qValues[coding] = q
+	}
+
+	var best string
+	var bestQ float64
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qValues[coding]
+		if !ok {
+			q, ok = qValues["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// startCompression decides whether the response being committed is
+// compressed and rewrites its headers accordingly. It reports whether an
+// encoder has to be set up once the headers are written.
+func (w *Writer) startCompression(h *headers.Headers, statusCode StatusCode, final bool) bool {
+	if !bodyAllowed(statusCode) || statusCode == StatusPartialContent {
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	if _, ok := h.Get("Content-Range"); ok {
+		return false
+	}
+	if _, ok := h.Get("Transfer-Encoding"); ok {
+		return false
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) && contentType != "image/svg+xml" {
+			return false
+		}
+	}
+
+	// the response varies with Accept-Encoding whether or not this client
+	// gets it compressed
+	if !hasToken(h, "Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if w.compression.encoding == "" {
+		return false
+	}
+	size := len(w.buf)
+	if value, ok := h.Get("Content-Length"); ok {
+		size, _ = strconv.Atoi(value)
+	} else if !final {
+		size = w.compression.opts.MinSize
+	}
+	if size < w.compression.opts.MinSize {
+		return false
+	}
+
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.compression.encoding)
+	h.Set("Transfer-Encoding", "chunked")
+	if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	return true
+}
+
+func (w *Writer) newEncoder() (bodyEncoder, error) {
+	level := w.compression.opts.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	if w.compression.encoding == "gzip" {
+		return gzip.NewWriterLevel(chunkWriter{w}, level)
+	}
+	return zlib.NewWriterLevel(chunkWriter{w}, level)
+}
@@ -0,0 +1,167 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httputil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressed(t *testing.T, acceptEncoding string, opts CompressOptions, setup func(w *Writer), body string) (string, string) {
+	t.Helper()
+	w, buf := newTestWriter()
+	w.Compress(acceptEncoding, opts)
+	if setup != nil {
+		setup(w)
+	}
+	_, err := io.WriteString(w, body)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	head, payload, found := strings.Cut(buf.String(), "\r\n\r\n")
+	require.True(t, found)
+	return head + "\r\n", payload
+}
+
+func decode(t *testing.T, encoding, payload string) string {
+	t.Helper()
+	var r io.Reader = httputil.NewChunkedReader(strings.NewReader(payload))
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"gzip, deflate, br", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"gzip;q=0.8, deflate;q=0.8", "gzip"},
+		{"x-gzip", "gzip"},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br, identity", ""},
+		{"gzip;q=abc", ""},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.encoding, negotiateEncoding(tc.acceptEncoding), tc.acceptEncoding)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	text := strings.Repeat("hello compression ", 100)
+
+	// Test: Compressed body is chunked with Content-Encoding and Vary
+	for _, encoding := range []string{"gzip", "deflate"} {
+		head, payload := compressed(t, encoding, CompressOptions{}, nil, text)
+		assert.Contains(t, head, "Content-Encoding: "+encoding+"\r\n")
+		assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+		assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+		assert.NotContains(t, head, "Content-Length")
+		assert.Less(t, len(payload), len(text))
+		assert.Equal(t, text, decode(t, encoding, payload))
+	}
+
+	// Test: Handler Content-Length is dropped and a strong ETag made weak
+	head, payload := compressed(t, "gzip", CompressOptions{}, func(w *Writer) {
+		w.Header().Set("Content-Length", "1800")
+		w.Header().Set("ETag", `"v1"`)
+	}, text)
+	assert.NotContains(t, head, "Content-Length")
+	assert.Contains(t, head, "ETag: W/\"v1\"\r\n")
+	assert.Equal(t, text, decode(t, "gzip", payload))
+
+	// Test: Streaming output larger than the buffer
+	big := strings.Repeat("0123456789", bufferedBodySize)
+	head, payload = compressed(t, "gzip", CompressOptions{MinSize: 1 << 20}, nil, big)
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Equal(t, big, decode(t, "gzip", payload))
+
+	// Test: Client without a supported encoding still gets Vary
+	head, payload = compressed(t, "br", CompressOptions{}, nil, text)
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Equal(t, text, payload)
+
+	// Test: Bodies under the threshold are sent as is
+	head, payload = compressed(t, "gzip", CompressOptions{MinSize: 1024}, nil, "short")
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Content-Length: 5\r\n")
+	assert.Equal(t, "short", payload)
+
+	// Test: Already compressed media and encoded or partial responses are skipped
+	for _, setup := range []func(w *Writer){
+		func(w *Writer) { w.Header().Set("Content-Type", "video/mp4") },
+		func(w *Writer) { w.Header().Set("Content-Type", "image/png") },
+		func(w *Writer) { w.Header().Set("Content-Encoding", "br") },
+		func(w *Writer) { w.SetStatus(StatusPartialContent) },
+	} {
+		head, payload = compressed(t, "gzip", CompressOptions{}, setup, text)
+		assert.NotContains(t, head, "Content-Encoding: gzip")
+		assert.Equal(t, text, payload)
+	}
+
+	// Test: Flush pushes compressed data out before the body is complete
+	w, buf := newTestWriter()
+	w.Compress("gzip", CompressOptions{})
+	_, err := io.WriteString(w, "first")
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Flush())
+	flushed := buf.Len()
+	_, err = io.WriteString(w, "second")
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Greater(t, buf.Len(), flushed)
+	require.NoError(t, w.Finish())
+	_, payload, _ = strings.Cut(buf.String(), "\r\n\r\n")
+	assert.Equal(t, "firstsecond", decode(t, "gzip", payload))
+
+	// Test: HTTP/1.0 clients get a close-delimited compressed body
+	w, buf = newTestWriter()
+	w.UseHTTP10()
+	w.Compress("gzip", CompressOptions{})
+	_, err = io.WriteString(w, text)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	head, payload, _ = strings.Cut(buf.String(), "\r\n\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Transfer-Encoding")
+	gz, err := gzip.NewReader(strings.NewReader(payload))
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(data))
+	assert.False(t, w.KeepAlive())
+
+	// Test: HEAD sends the same headers without a body
+	w, buf = newTestWriter()
+	w.DiscardBody()
+	w.Compress("gzip", CompressOptions{})
+	_, err = io.WriteString(w, text)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Encoding: gzip\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")))
+}
@@ -3,29 +3,66 @@ package response
 import (
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 
 	"github.com/delroscol98/httpfromtcp/internal/headers"
 )
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
-	h.SetHeaders("Content-Length", fmt.Sprintf("%d", contentLen))
-	h.SetHeaders("Connection", "close")
-	h.SetHeaders("Content-Type", "text/plain")
+	h.Add("Content-Length", fmt.Sprintf("%d", contentLen))
+	h.Add("Content-Type", "text/plain")
 
 	return h
 }
 
-func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	for key, val := range headers {
-		_, err := fmt.Fprintf(w, "%s: %s\r\n", key, val)
-		if err != nil {
-			return fmt.Errorf("Error writing headers: %w", err)
-		}
+// DefaultHeaderPriority lists the fields a Writer sends ahead of all others
+// unless its HeaderPriority says otherwise.
+var DefaultHeaderPriority = []string{"Date", "Server"}
+
+func WriteHeaders(w io.Writer, headers *headers.Headers) error {
+	err := headers.Validate()
+	if err != nil {
+		return err
 	}
-	_, err := w.Write([]byte("\r\n"))
+
+	_, err = w.Write(appendHeaderBlock(nil, headers, DefaultHeaderPriority))
 	if err != nil {
-		return fmt.Errorf("Error writing CRLF: %w", err)
+		return fmt.Errorf("Error writing headers: %w", err)
 	}
 	return nil
 }
+
+// appendHeaderBlock appends the field lines of h followed by the empty line
+// that ends the section. Names are written in canonical case; the fields
+// named in priority come first in that order, then the rest in the order
+// they were added.
+func appendHeaderBlock(buf []byte, h *headers.Headers, priority []string) []byte {
+	isPriority := func(name string) bool {
+		return slices.ContainsFunc(priority, func(p string) bool {
+			return strings.EqualFold(p, name)
+		})
+	}
+
+	for _, p := range priority {
+		for name, value := range h.All() {
+			if strings.EqualFold(name, p) {
+				buf = appendField(buf, name, value)
+			}
+		}
+	}
+	for name, value := range h.All() {
+		if !isPriority(name) {
+			buf = appendField(buf, name, value)
+		}
+	}
+	return append(buf, "\r\n"...)
+}
+
+func appendField(buf []byte, name, value string) []byte {
+	buf = append(buf, headers.CanonicalKey(name)...)
+	buf = append(buf, ": "...)
+	buf = append(buf, value...)
+	return append(buf, "\r\n"...)
+}
@@ -0,0 +1,232 @@
+package response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/delroscol98/httpfromtcp/internal/headers"
+	"github.com/delroscol98/httpfromtcp/internal/request"
+)
+
+// maxRanges bounds how many ranges a single request may ask for before the
+// Range header is ignored and the full content is sent.
+const maxRanges = 32
+
+var errUnsatisfiableRange = errors.New("no satisfiable range")
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// ServeContent sends content, honouring Range and If-Range for GET and HEAD
+// requests. Headers already set through w.Header(), such as Content-Type,
+// ETag and Last-Modified, are sent with the response and used to evaluate
+// If-Range. A single range is answered with 206 and Content-Range, several
+// ranges with a multipart/byteranges body and unsatisfiable ones with 416.
+func ServeContent(w *Writer, req *request.Request, content io.ReadSeeker) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+
+	rangeHeader, hasRange := req.Headers.Get("Range")
+	method := req.RequestLine.Method
+	if !hasRange || (method != "GET" && method != "HEAD") || !ifRangeMatches(req, h) {
+		return serveRange(w, content, byteRange{start: 0, length: size}, StatusOK)
+	}
+
+	ranges, err := parseRange(rangeHeader, size)
+	if errors.Is(err, errUnsatisfiableRange) {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		h.Set("Content-Length", "0")
+		w.SetStatus(StatusRangeNotSatisfiable)
+		return w.Flush()
+	}
+	if err != nil || len(ranges) > maxRanges {
+		// a Range header we cannot use is ignored, as RFC 9110 allows
+		return serveRange(w, content, byteRange{start: 0, length: size}, StatusOK)
+	}
+
+	if len(ranges) == 1 {
+		h.Set("Content-Range", ranges[0].contentRange(size))
+		return serveRange(w, content, ranges[0], StatusPartialContent)
+	}
+	return serveMultipartRanges(w, content, ranges, size)
+}
+
+func serveRange(w *Writer, content io.ReadSeeker, r byteRange, statusCode StatusCode) error {
+	_, err := content.Seek(r.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(r.length, 10))
+	w.SetStatus(statusCode)
+	err = w.Flush()
+	if err != nil || w.DiscardsBody() {
+		return err
+	}
+
+	_, err = io.CopyN(w, content, r.length)
+	return err
+}
+
+func serveMultipartRanges(w *Writer, content io.ReadSeeker, ranges []byteRange, size int64) error {
+	boundaryBytes := make([]byte, 16)
+	_, err := rand.Read(boundaryBytes)
+	if err != nil {
+		return err
+	}
+	boundary := hex.EncodeToString(boundaryBytes)
+
+	h := w.Header()
+	contentType, _ := h.Get("Content-Type")
+	partHeaders := make([]string, len(ranges))
+	var contentLength int64
+	for i, r := range ranges {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "\r\n--%s\r\n", boundary)
+		if contentType != "" {
+			fmt.Fprintf(&sb, "Content-Type: %s\r\n", contentType)
+		}
+		fmt.Fprintf(&sb, "Content-Range: %s\r\n\r\n", r.contentRange(size))
+		partHeaders[i] = sb.String()
+		contentLength += int64(len(partHeaders[i])) + r.length
+	}
+	closing := fmt.Sprintf("\r\n--%s--\r\n", boundary)
+	contentLength += int64(len(closing))
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	w.SetStatus(StatusPartialContent)
+	err = w.Flush()
+	if err != nil || w.DiscardsBody() {
+		return err
+	}
+
+	for i, r := range ranges {
+		_, err = io.WriteString(w, partHeaders[i])
+		if err != nil {
+			return err
+		}
+
+		_, err = content.Seek(r.start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(w, content, r.length)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, closing)
+	return err
+}
+
+// ifRangeMatches reports whether a Range header should be honoured given the
+// request's If-Range precondition, compared against the response's ETag
+// (strongly) or Last-Modified (exactly).
+func ifRangeMatches(req *request.Request, h *headers.Headers) bool {
+	ifRange, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag, ok := h.Get("ETag")
+		return ok && !strings.HasPrefix(ifRange, "W/") && !strings.HasPrefix(etag, "W/") && etag == ifRange
+	}
+
+	lastModified, ok := h.Get("Last-Modified")
+	return ok && lastModified == ifRange
+}
+
+// parseRange parses a "bytes=" Range header value against content of the
+// given size. Ranges that start past the end are dropped; if none are left
+// errUnsatisfiableRange is returned.
+func parseRange(value string, size int64) ([]byteRange, error) {
+	unit, specs, found := strings.Cut(value, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, fmt.Errorf("unsupported range unit: %s", value)
+	}
+
+	var ranges []byteRange
+	var specCount int
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specCount++
+
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, fmt.Errorf("malformed range: %s", spec)
+		}
+
+		if first == "" {
+			suffix, err := parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			suffix = min(suffix, size)
+			ranges = append(ranges, byteRange{start: size - suffix, length: suffix})
+			continue
+		}
+
+		start, err := parseRangeInt(first)
+		if err != nil {
+			return nil, err
+		}
+		end := size - 1
+		if last != "" {
+			end, err = parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("malformed range: %s", spec)
+			}
+		}
+
+		if start >= size {
+			continue
+		}
+		end = min(end, size-1)
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+
+	if specCount == 0 {
+		return nil, fmt.Errorf("malformed range: %s", value)
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+func parseRangeInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("malformed range: %s", s)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,33 @@
+package response
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	ranges, err := parseRange("bytes=0-4, 10-, -3", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []byteRange{{0, 5}, {10, 10}, {17, 3}}, ranges)
+
+	// Test: End and suffix are clamped to the content size
+	ranges, err = parseRange("bytes=15-100,-50", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []byteRange{{15, 5}, {0, 20}}, ranges)
+
+	// Test: Unsatisfiable ranges are dropped
+	ranges, err = parseRange("bytes=30-40, 5-6", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []byteRange{{5, 2}}, ranges)
+	_, err = parseRange("bytes=30-40, -0", 20)
+	assert.ErrorIs(t, err, errUnsatisfiableRange)
+
+	// Test: Malformed values
+	for _, value := range []string{"items=0-1", "bytes=", "bytes=5-1", "bytes=a-b", "bytes=1", "bytes=-1-2", "bytes=+1-2"} {
+		_, err = parseRange(value, 20)
+		assert.Error(t, err, value)
+		assert.NotErrorIs(t, err, errUnsatisfiableRange, value)
+	}
+}
@@ -0,0 +1,102 @@
+package response_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeContent(t *testing.T) {
+	// Test: No Range sends everything and advertises range support
+	res := servertest.Serve(t, serveText(t, nil), "GET", "/video", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Accept-Ranges: bytes\r\n")
+	assert.Contains(t, res, "Content-Length: 20\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n0123456789abcdefghij"))
+
+	// Test: Single range
+	res = servertest.Serve(t, serveText(t, nil), "GET", "/video", "Range: bytes=5-9\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, res, "Content-Range: bytes 5-9/20\r\n")
+	assert.Contains(t, res, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n56789"))
+
+	// Test: Multiple ranges
+	withType := func(w *response.Writer) { w.Header().Set("Content-Type", "text/plain") }
+	res = servertest.Serve(t, serveText(t, withType), "GET", "/video", "Range: bytes=0-1,-2\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, res, "Content-Type: multipart/byteranges; boundary=")
+	_, body, _ := strings.Cut(res, "\r\n\r\n")
+	boundary := body[4:36]
+	assert.Equal(t, "\r\n--"+boundary+"\r\nContent-Type: text/plain\r\nContent-Range: bytes 0-1/20\r\n\r\n01"+
+		"\r\n--"+boundary+"\r\nContent-Type: text/plain\r\nContent-Range: bytes 18-19/20\r\n\r\nij"+
+		"\r\n--"+boundary+"--\r\n", body)
+	assert.Contains(t, res, fmt.Sprintf("Content-Length: %d\r\n", len(body)))
+
+	// Test: Unsatisfiable range
+	res = servertest.Serve(t, serveText(t, nil), "GET", "/video", "Range: bytes=50-\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, res, "Content-Range: bytes */20\r\n")
+
+	// Test: Malformed range is ignored
+	res = servertest.Serve(t, serveText(t, nil), "GET", "/video", "Range: bytes=9-3\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Range on other methods is ignored
+	res = servertest.Serve(t, serveText(t, nil), "POST", "/video", "Range: bytes=0-1\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Range with a matching and a stale ETag
+	withETag := func(w *response.Writer) { w.Header().Set("ETag", `"v1"`) }
+	res = servertest.Serve(t, serveText(t, withETag), "GET", "/video", "Range: bytes=0-1\r\nIf-Range: \"v1\"\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	res = servertest.Serve(t, serveText(t, withETag), "GET", "/video", "Range: bytes=0-1\r\nIf-Range: \"v0\"\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Range with a date
+	withDate := func(w *response.Writer) { w.Header().Set("Last-Modified", "Tue, 15 Nov 1994 08:12:31 GMT") }
+	res = servertest.Serve(t, serveText(t, withDate), "GET", "/video", "Range: bytes=0-1\r\nIf-Range: Tue, 15 Nov 1994 08:12:31 GMT\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	res = servertest.Serve(t, serveText(t, withDate), "GET", "/video", "Range: bytes=0-1\r\nIf-Range: Wed, 16 Nov 1994 08:12:31 GMT\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: HEAD keeps the range headers without reading the content
+	for _, rangeHeader := range []string{"", "Range: bytes=0-1\r\n", "Range: bytes=0-1,4-5\r\n"} {
+		var writer *response.Writer
+		res = servertest.Serve(t, func(w *response.Writer, req *request.Request) {
+			writer = w
+			require.NoError(t, response.ServeContent(w, req, unreadable{strings.NewReader("0123456789")}))
+		}, "HEAD", "/video", rangeHeader)
+		assert.Contains(t, res, "Content-Length: ", rangeHeader)
+		assert.True(t, strings.HasSuffix(res, "\r\n\r\n"), rangeHeader)
+		assert.True(t, writer.KeepAlive(), rangeHeader)
+	}
+}
+
+// serveText returns a handler serving fixed text with ServeContent after
+// setup, if any, has set response headers.
+func serveText(t *testing.T, setup func(w *response.Writer)) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		if setup != nil {
+			setup(w)
+		}
+		require.NoError(t, response.ServeContent(w, req, strings.NewReader("0123456789abcdefghij")))
+	}
+}
+
+// unreadable is content that may be seeked but not read.
+type unreadable struct {
+	io.Seeker
+}
+
+func (unreadable) Read(p []byte) (int, error) {
+	return 0, errors.New("content read for a discarded body")
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/delroscol98/httpfromtcp/internal/headers"
 )
@@ -15,9 +17,13 @@ const (
 	WritingHeaders
 	WritingBody
 	WritingTrailers
+	WritingDone
 )
 
-const HTTPVersion = "HTTP/1.1"
+const (
+	HTTPVersion   = "HTTP/1.1"
+	HTTP10Version = "HTTP/1.0"
+)
 
 type StatusLine struct {
 	HttpVersion  string
@@ -28,51 +34,236 @@ type StatusLine struct {
 type Writer struct {
 	Writer io.Writer
 	State  WriterState
+	// HeaderPriority names the fields sent before all others, in order. Nil
+	// means DefaultHeaderPriority.
+	HeaderPriority []string
+
+	statusCode      StatusCode
+	chunked         bool
+	trailers        map[string]bool
+	closeConnection bool
+	discardBody     bool
+	bodyBytes       int
+	http10          bool
+	// contentLength is the declared length of a body sent with
+	// Content-Length, or -1 when the body is framed some other way
+	contentLength int
+	bodyWritten   int
+	// closeDelimited is set when a chunked response goes to an HTTP/1.0
+	// client: chunks are sent without framing and the body ends when the
+	// connection closes
+	closeDelimited bool
+
+	// state for the buffered io.Writer mode, see Write
+	buffered      bool
+	header        *headers.Headers
+	pendingStatus StatusCode
+	buf           []byte
+	compression   *compression
+	encoder       bodyEncoder
+}
+
+// ChunkExtension is a name/value pair sent after a chunk's size. The value is
+// optional and is quoted when it is not a token.
+type ChunkExtension struct {
+	Name  string
+	Value string
+}
+
+// CloseAfterResponse marks the connection to be closed once the response is
+// written. Headers written afterwards will carry "Connection: close".
+func (w *Writer) CloseAfterResponse() {
+	w.closeConnection = true
+}
+
+// KeepAlive reports whether the connection can be reused for another request,
+// which requires a complete, self-delimited response.
+func (w *Writer) KeepAlive() bool {
+	return !w.closeConnection && w.State == WritingDone
+}
+
+// write sends p to the connection. A failed write leaves the response in an
+// unknown state, so the connection must not be reused.
+func (w *Writer) write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if err != nil {
+		w.closeConnection = true
+	}
+	return n, err
+}
+
+// writeBody sends message body bytes, including chunk framing and trailers,
+// which are dropped for responses that must not carry content.
+func (w *Writer) writeBody(p []byte) (int, error) {
+	if w.discardBody {
+		return len(p), nil
+	}
+	return w.write(p)
+}
+
+// DiscardBody makes the Writer drop every body byte while still sending the
+// status line and headers the body would have produced, as needed to answer
+// a HEAD request with the GET handler.
+func (w *Writer) DiscardBody() {
+	w.discardBody = true
+}
+
+// DiscardsBody reports whether body bytes are being dropped, letting callers
+// skip producing a body nobody will receive.
+func (w *Writer) DiscardsBody() bool {
+	return w.discardBody
+}
+
+// UseHTTP10 makes the Writer answer an HTTP/1.0 client. The status line
+// carries HTTP/1.0, interim responses are refused, a kept-alive connection is
+// announced with "Connection: keep-alive" and chunked bodies are sent
+// close-delimited instead, dropping their trailers.
+func (w *Writer) UseHTTP10() {
+	w.http10 = true
+}
+
+// StatusCode returns the status code of the final response, or 0 if its
+// status line has not been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	if w.State == WritingStatusLine {
+		return 0
+	}
+	return w.statusCode
+}
+
+// BytesWritten returns how many bytes of content have been sent, after any
+// compression and without chunk framing. Discarded HEAD bodies count as 0.
+func (w *Writer) BytesWritten() int {
+	return w.bodyBytes
+}
+
+// countBody records n content bytes sent to the client.
+func (w *Writer) countBody(n int) {
+	if !w.discardBody {
+		w.bodyBytes += n
+	}
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes a status line with a custom reason phrase. Any
+// three-digit status code is accepted, registered or not.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reasonPhrase string) error {
 	if w.State != WritingStatusLine {
 		return errors.New("Writer state needs to be updated for writing status line")
 	}
 
-	var reasonPhrase string
-	switch statusCode {
-	case StatusBadRequest:
-		reasonPhrase = "Bad Request"
-	case StatusInternalServerError:
-		reasonPhrase = "Internal Server Error"
-	case StatusOK:
-		reasonPhrase = "OK"
-	default:
-		return errors.New("unknown status code")
+	if !ValidStatusCode(statusCode) {
+		return fmt.Errorf("invalid status code: %d", statusCode)
+	}
+
+	for _, c := range []byte(reasonPhrase) {
+		if c != '\t' && (c < ' ' || c == 0x7f) {
+			return fmt.Errorf("invalid reason phrase: %q", reasonPhrase)
+		}
 	}
 
-	statusLine := fmt.Appendf(make([]byte, 0), "%v %v %v\r\n", HTTPVersion, statusCode, reasonPhrase)
+	version := HTTPVersion
+	if w.http10 {
+		if statusCode < 200 {
+			return fmt.Errorf("status %d cannot be sent to an HTTP/1.0 client", statusCode)
+		}
+		version = HTTP10Version
+	}
+	statusLine := fmt.Appendf(make([]byte, 0), "%v %v %v\r\n", version, int(statusCode), reasonPhrase)
 
-	_, err := w.Writer.Write(statusLine)
+	_, err := w.write(statusLine)
 	if err != nil {
 		return fmt.Errorf("Error writing status line: %v", err)
 	}
 
+	w.statusCode = statusCode
 	w.State = WritingHeaders
 	return nil
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.State != WritingHeaders {
 		return errors.New("Writer state needs to be updated for writing headers")
 	}
 
-	for key, value := range h {
-		headers := fmt.Appendf(make([]byte, 0), "%s: %s\r\n", key, value)
-		_, err := w.Writer.Write(headers)
-		if err != nil {
-			return fmt.Errorf("Error writing headers: %v", err)
+	// nothing is written for invalid fields, so a value carrying CR or LF
+	// cannot split the response
+	err := h.Validate()
+	if err != nil {
+		return err
+	}
+
+	interim := w.statusCode < 200
+	hasBody := bodyAllowed(w.statusCode)
+	if !hasBody {
+		if hasToken(h, "Transfer-Encoding", "chunked") {
+			return fmt.Errorf("status %d does not allow a body", w.statusCode)
+		}
+		if interim || w.statusCode == StatusNoContent {
+			h.Del("Content-Length")
+		}
+	}
+
+	w.chunked = hasBody && hasToken(h, "Transfer-Encoding", "chunked")
+	w.trailers = make(map[string]bool)
+	if w.chunked {
+		value, _ := h.Get("Trailer")
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" {
+				w.trailers[name] = true
+			}
+		}
+	}
+	w.contentLength = -1
+	w.bodyWritten = 0
+	if value, ok := h.Get("Content-Length"); ok && hasBody && !w.chunked {
+		w.contentLength, err = strconv.Atoi(value)
+		if err != nil || w.contentLength < 0 {
+			return fmt.Errorf("invalid Content-Length: %s", value)
 		}
 	}
+	if w.chunked && w.http10 {
+		// HTTP/1.0 has no chunked coding
+		h.Del("Transfer-Encoding")
+		h.Del("Trailer")
+		w.closeDelimited = true
+		w.closeConnection = true
+	}
 
-	_, err := w.Writer.Write([]byte("\r\n"))
-	w.State = WritingBody
+	if w.statusCode == StatusSwitchingProtocols {
+		w.closeConnection = true
+	}
+	if !interim {
+		if !w.closeConnection {
+			w.closeConnection = hasToken(h, "Connection", "close") || (hasBody && !isFramed(h))
+		}
+		switch {
+		case w.closeConnection:
+			h.Set("Connection", "close")
+		case w.http10:
+			// an HTTP/1.0 client closes the connection unless told otherwise
+			h.Set("Connection", "keep-alive")
+		}
+	}
+
+	priority := w.HeaderPriority
+	if priority == nil {
+		priority = DefaultHeaderPriority
+	}
+	_, err = w.write(appendHeaderBlock(nil, h, priority))
+	switch {
+	case interim && w.statusCode != StatusSwitchingProtocols:
+		// an interim response is followed by the final one
+		w.State = WritingStatusLine
+	case !hasBody:
+		w.State = WritingDone
+	default:
+		w.State = WritingBody
+	}
 	if err != nil {
 		return fmt.Errorf("Error writing headers: %v", err)
 	}
@@ -81,37 +272,106 @@ func (w *Writer) WriteHeaders(h headers.Headers) error {
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.State == WritingDone && !bodyAllowed(w.statusCode) {
+		if len(p) > 0 {
+			return 0, fmt.Errorf("status %d does not allow a body", w.statusCode)
+		}
+		return 0, nil
+	}
+
 	if w.State != WritingBody {
 		return 0, errors.New("Writer state needs to be updated for writing body")
 	}
+	if w.chunked {
+		return 0, errors.New("chunked response body must be written with WriteChunkedBody")
+	}
 
-	n, err := w.Writer.Write(p)
-	w.State = WritingStatusLine
+	if w.contentLength >= 0 && len(p) > w.contentLength {
+		return 0, fmt.Errorf("body exceeds Content-Length of %d bytes", w.contentLength)
+	}
+
+	n, err := w.writeBody(p)
+	w.bodyWritten += n
+	w.countBody(n)
+	// the client would read whatever follows a short body as the rest of it
+	if w.contentLength >= 0 && w.bodyWritten < w.contentLength && !w.discardBody {
+		w.closeConnection = true
+	}
+	w.State = WritingDone
 	if err != nil {
 		return n, fmt.Errorf("Error writing body: %v", err)
 	}
 	return n, nil
 }
 
+// WriteChunkedBody sends p as a single chunk, adding the size line and the
+// trailing CRLF. Empty writes are skipped since a zero-size chunk ends the
+// body; use WriteChunkedBodyDone for that.
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	return w.WriteChunkedBodyExt(p)
+}
+
+// WriteChunkedBodyExt is like WriteChunkedBody but sends chunk extensions
+// after the chunk size.
+func (w *Writer) WriteChunkedBodyExt(p []byte, extensions ...ChunkExtension) (int, error) {
 	if w.State != WritingBody {
 		return 0, errors.New("Writer state needs to be updated for writing chunked body")
 	}
+	if !w.chunked {
+		return 0, errors.New("response is not using chunked transfer-encoding")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
 
-	n, err := w.Writer.Write(p)
+	ext, err := formatChunkExtensions(extensions)
 	if err != nil {
-		return n, fmt.Errorf("Error writing chunked body: %v", err)
+		return 0, err
 	}
-	return n, nil
+
+	if w.closeDelimited {
+		n, err := w.writeBody(p)
+		w.countBody(n)
+		if err != nil {
+			return n, fmt.Errorf("Error writing body: %v", err)
+		}
+		return n, nil
+	}
+
+	chunk := fmt.Appendf(make([]byte, 0, len(p)+32), "%x%s\r\n", len(p), ext)
+	chunk = append(chunk, p...)
+	chunk = append(chunk, "\r\n"...)
+	_, err = w.writeBody(chunk)
+	if err != nil {
+		return 0, fmt.Errorf("Error writing chunked body: %v", err)
+	}
+	w.countBody(len(p))
+	return len(p), nil
 }
 
+// WriteChunkedBodyDone sends the terminating zero-size chunk. If the response
+// declared trailers in its Trailer header they must follow via WriteTrailers,
+// otherwise the body is finished here.
 func (w *Writer) WriteChunkedBodyDone() error {
 	if w.State != WritingBody {
 		return errors.New("Writer state needs to be updated for writing chunked body")
 	}
+	if !w.chunked {
+		return errors.New("response is not using chunked transfer-encoding")
+	}
 
-	_, err := w.Writer.Write([]byte("0\r\n"))
+	last := []byte("0\r\n")
 	w.State = WritingTrailers
+	if len(w.trailers) == 0 {
+		last = append(last, "\r\n"...)
+		w.State = WritingDone
+	}
+
+	if w.closeDelimited {
+		return nil
+	}
+
+	_, err := w.writeBody(last)
 	if err != nil {
 		return fmt.Errorf("Error writing end of chunked body: %v", err)
 	}
@@ -119,23 +379,97 @@ func (w *Writer) WriteChunkedBodyDone() error {
 	return nil
 }
 
-func (w *Writer) WriteTrailers(t headers.Headers) error {
+// WriteTrailers sends the trailer section and the final CRLF. Only fields
+// declared in the response's Trailer header may be sent.
+func (w *Writer) WriteTrailers(t *headers.Headers) error {
 	if w.State != WritingTrailers {
 		return errors.New("Writer state needs to be updated for writing trailers")
 	}
 
-	for key, value := range t {
-		trailer := fmt.Appendf(make([]byte, 0), "%s: %s\r\n", key, value)
-		_, err := w.Writer.Write(trailer)
-		if err != nil {
-			return fmt.Errorf("Error writing trailers: %v", err)
+	for key := range t.All() {
+		if !w.trailers[strings.ToLower(key)] {
+			return fmt.Errorf("trailer %s was not declared in the Trailer header", key)
 		}
 	}
+	err := t.Validate()
+	if err != nil {
+		return err
+	}
+	if w.closeDelimited {
+		w.State = WritingDone
+		return nil
+	}
 
-	_, err := w.Writer.Write([]byte("\r\n"))
-	w.State = WritingStatusLine
+	_, err = w.writeBody(appendHeaderBlock(nil, t, nil))
+	w.State = WritingDone
 	if err != nil {
 		return fmt.Errorf("Error writing trailers: %v", err)
 	}
 	return nil
 }
+
+func formatChunkExtensions(extensions []ChunkExtension) (string, error) {
+	var sb strings.Builder
+	for _, ext := range extensions {
+		if ext.Name == "" || !isToken(ext.Name) {
+			return "", fmt.Errorf("invalid chunk extension name: %q", ext.Name)
+		}
+
+		sb.WriteString(";")
+		sb.WriteString(ext.Name)
+		if ext.Value == "" {
+			continue
+		}
+
+		sb.WriteString("=")
+		if isToken(ext.Value) {
+			sb.WriteString(ext.Value)
+			continue
+		}
+
+		quoted, err := quoteString(ext.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid chunk extension value for %s: %w", ext.Name, err)
+		}
+		sb.WriteString(quoted)
+	}
+	return sb.String(), nil
+}
+
+func isToken(s string) bool {
+	return s != "" && (*headers.Headers)(nil).ValidateKey(s)
+}
+
+// quoteString produces an RFC 9110 quoted-string.
+func quoteString(s string) (string, error) {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range []byte(s) {
+		if c != '\t' && (c < ' ' || c == 0x7f) {
+			return "", fmt.Errorf("control character in %q", s)
+		}
+		if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('"')
+	return sb.String(), nil
+}
+
+func hasToken(h *headers.Headers, key, token string) bool {
+	value, _ := h.Get(key)
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFramed(h *headers.Headers) bool {
+	if _, exists := h.Get("Content-Length"); exists {
+		return true
+	}
+	return hasToken(h, "Transfer-Encoding", "chunked")
+}
@@ -0,0 +1,462 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWriter() (*Writer, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return &Writer{Writer: &buf, State: WritingStatusLine}, &buf
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered status codes use their reason phrase
+	for statusCode, reasonPhrase := range map[StatusCode]string{
+		StatusCreated:            "Created",
+		StatusMovedPermanently:   "Moved Permanently",
+		StatusNotFound:           "Not Found",
+		StatusServiceUnavailable: "Service Unavailable",
+	} {
+		w, buf := newTestWriter()
+		require.NoError(t, w.WriteStatusLine(statusCode))
+		assert.Equal(t, fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reasonPhrase), buf.String())
+	}
+
+	// Test: Unregistered code with a custom reason phrase
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLineReason(299, "Custom Thing"))
+	assert.Equal(t, "HTTP/1.1 299 Custom Thing\r\n", buf.String())
+
+	// Test: Unregistered code without a reason phrase
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(599))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+
+	// Test: Invalid codes and reason phrases
+	w, _ = newTestWriter()
+	assert.Error(t, w.WriteStatusLine(99))
+	assert.Error(t, w.WriteStatusLine(1000))
+	assert.Error(t, w.WriteStatusLineReason(200, "OK\r\nX-Injected: 1"))
+}
+
+func TestBodylessStatus(t *testing.T) {
+	// Test: 204 drops Content-Length and refuses a body
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	_, err := w.WriteBody([]byte("nope"))
+	assert.Error(t, err)
+	_, err = w.WriteBody(nil)
+	assert.NoError(t, err)
+	assert.True(t, w.KeepAlive())
+
+	// Test: 304 keeps Content-Length but cannot be chunked
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(42)))
+	assert.Contains(t, buf.String(), "Content-Length: 42\r\n")
+	assert.True(t, w.KeepAlive())
+
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	assert.Error(t, w.WriteHeaders(h))
+
+	// Test: Interim 1xx response is followed by the final response
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusContinue))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err = w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n")))
+}
+
+func TestWriteHeaders(t *testing.T) {
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := GetDefaultHeaders(0)
+	h.Add("Set-Cookie", "session=abc; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	h.Add("Set-Cookie", "theme=dark")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: session=abc; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n"+
+		"Set-Cookie: theme=dark\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteBodyLength(t *testing.T) {
+	// Test: A body matching Content-Length keeps the connection
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: A short body closes the connection
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+	_, err = w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+
+	// Test: A body longer than Content-Length is refused
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	n, err := w.WriteBody([]byte("abc"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func TestWriteInvalidHeaders(t *testing.T) {
+	// Test: Nothing is written for a value that would split the response
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusFound))
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/x\r\nSet-Cookie: admin=1")
+	err := w.WriteHeaders(h)
+	require.ErrorIs(t, err, headers.ErrInvalidValue)
+	assert.Contains(t, err.Error(), "Location")
+	assert.Equal(t, "HTTP/1.1 302 Found\r\n", buf.String())
+	assert.Equal(t, WritingHeaders, w.State)
+
+	// Test: Buffered mode refuses before the status line
+	w, buf = newTestWriter()
+	w.Header().Set("X-User", "evil\nInjected: yes")
+	_, err = w.Write([]byte("body"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Finish(), headers.ErrInvalidValue)
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, WritingStatusLine, w.State)
+
+	// Test: Trailers are checked too
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Checksum")))
+	require.NoError(t, w.WriteChunkedBodyDone())
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "1\r\n\r\ninjected")
+	require.ErrorIs(t, w.WriteTrailers(trailers), headers.ErrInvalidValue)
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func TestHeaderOrder(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Set("x-request-id", "42")
+	h.Set("server", "httpfromtcp")
+	h.Set("content-length", "0")
+	h.Set("date", "Fri, 01 Mar 2024 12:00:00 GMT")
+
+	// Test: Priority fields first, then insertion order, in a single write
+	var out countingWriter
+	w := &Writer{Writer: &out, State: WritingStatusLine}
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, 2, out.writes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Date: Fri, 01 Mar 2024 12:00:00 GMT\r\n"+
+		"Server: httpfromtcp\r\n"+
+		"X-Request-Id: 42\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", out.String())
+
+	// Test: Custom priority, and none at all
+	w, buf := newTestWriter()
+	w.HeaderPriority = []string{"Content-Length"}
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Contains(t, buf.String(), "200 OK\r\nContent-Length: 0\r\nX-Request-Id: 42\r\nServer: httpfromtcp\r\nDate: ")
+
+	w, buf = newTestWriter()
+	w.HeaderPriority = []string{}
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Contains(t, buf.String(), "200 OK\r\nX-Request-Id: 42\r\nServer: httpfromtcp\r\nContent-Length: 0\r\nDate: ")
+}
+
+func chunkedHeaders(trailer string) *headers.Headers {
+	h := GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	if trailer != "" {
+		h.Set("Trailer", trailer)
+	}
+	return h
+}
+
+func TestWriteChunkedBody(t *testing.T) {
+	// Test: Writer frames chunks and terminates the body
+	w, buf := newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("")))
+	buf.Reset()
+	n, err := w.WriteChunkedBody([]byte("hello world!"))
+	require.NoError(t, err)
+	assert.Equal(t, 12, n)
+	n, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = w.WriteChunkedBodyExt([]byte("x"), ChunkExtension{Name: "sig", Value: "abc"}, ChunkExtension{Name: "note", Value: `a "b"`}, ChunkExtension{Name: "last"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteChunkedBodyDone())
+	assert.Equal(t, "c\r\nhello world!\r\n1;sig=abc;note=\"a \\\"b\\\"\";last\r\nx\r\n0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Declared trailers are required and validated
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Checksum")))
+	buf.Reset()
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteChunkedBodyDone())
+	assert.False(t, w.KeepAlive())
+
+	undeclared := headers.NewHeaders()
+	undeclared.Set("X-Other", "1")
+	assert.Error(t, w.WriteTrailers(undeclared))
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "123")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "3\r\nabc\r\n0\r\nX-Checksum: 123\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Framing mismatches are rejected
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	assert.Error(t, err)
+
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("")))
+	_, err = w.WriteBody([]byte("abc"))
+	assert.Error(t, err)
+	_, err = w.WriteChunkedBodyExt([]byte("abc"), ChunkExtension{Name: "bad name"})
+	assert.Error(t, err)
+}
+
+func TestHTTP10Writer(t *testing.T) {
+	// Test: Status line version and keep-alive announcement
+	w, buf := newTestWriter()
+	w.UseHTTP10()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.0 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Connection: keep-alive\r\n")
+	assert.True(t, w.KeepAlive())
+
+	w, buf = newTestWriter()
+	w.UseHTTP10()
+	w.CloseAfterResponse()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Contains(t, buf.String(), "Connection: close\r\n")
+	assert.NotContains(t, buf.String(), "keep-alive")
+
+	// Test: Interim responses are refused
+	w, buf = newTestWriter()
+	w.UseHTTP10()
+	assert.Error(t, w.WriteStatusLine(StatusContinue))
+	assert.Equal(t, "", buf.String())
+
+	// Test: Chunked bodies are sent close-delimited and trailers dropped
+	w, buf = newTestWriter()
+	w.UseHTTP10()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Checksum")))
+	_, err = w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyExt([]byte("world"), ChunkExtension{Name: "sig"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteChunkedBodyDone())
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "123")
+	require.NoError(t, w.WriteTrailers(trailers))
+	head, body, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	assert.NotContains(t, head, "Transfer-Encoding")
+	assert.NotContains(t, head, "Trailer")
+	assert.Contains(t, head, "Connection: close")
+	assert.Equal(t, "hello world", body)
+	assert.Equal(t, 11, w.BytesWritten())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Buffered bodies too large to hold back are close-delimited
+	w, buf = newTestWriter()
+	w.UseHTTP10()
+	big := strings.Repeat("a", bufferedBodySize+10)
+	_, err = io.WriteString(w, big)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	head, body, _ = strings.Cut(buf.String(), "\r\n\r\n")
+	assert.NotContains(t, head, "Transfer-Encoding")
+	assert.NotContains(t, head, "Content-Length")
+	assert.Equal(t, big, body)
+	assert.False(t, w.KeepAlive())
+}
+
+func TestBufferedWrite(t *testing.T) {
+	// Test: Small body gets an implicit 200 and a Content-Length
+	w, buf := newTestWriter()
+	w.Header().Set("Content-Type", "application/json")
+	n, err := fmt.Fprintf(w, `{"hello":%q}`, "world")
+	require.NoError(t, err)
+	assert.Equal(t, 17, n)
+	assert.Equal(t, "", buf.String())
+	require.NoError(t, w.Finish())
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("HTTP/1.1 200 OK\r\n")))
+	assert.Contains(t, buf.String(), "Content-Length: 17\r\n")
+	assert.Contains(t, buf.String(), "Content-Type: application/json\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n{\"hello\":\"world\"}")))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Large body switches to chunked encoding
+	w, buf = newTestWriter()
+	w.SetStatus(StatusCreated)
+	big := bytes.Repeat([]byte("a"), bufferedBodySize+10)
+	_, err = io.Copy(w, bytes.NewReader(big))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	res := buf.String()
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 201 Created\r\n"))
+	assert.Contains(t, res, "Transfer-Encoding: chunked\r\n")
+	assert.NotContains(t, res, "Content-Length")
+	assert.True(t, strings.HasSuffix(res, "\r\n0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Flush sends headers and partial output early
+	w, buf = newTestWriter()
+	_, err = w.Write([]byte("part one"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n8\r\npart one\r\n"))
+	_, err = w.Write([]byte("two"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "3\r\ntwo\r\n0\r\n\r\n"))
+
+	// Test: Handler supplied Content-Length is used as is
+	w, buf = newTestWriter()
+	w.Header().Set("Content-Length", "5")
+	require.NoError(t, w.Flush())
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("!"))
+	assert.Error(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "Content-Length: 5\r\n\r\nhello"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Short body for a declared Content-Length closes the connection
+	w, _ = newTestWriter()
+	w.Header().Set("Content-Length", "5")
+	require.NoError(t, w.Flush())
+	_, err = w.Write([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Write after explicit headers follows their Content-Length
+	w, buf = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "5")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("!"))
+	assert.Error(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	w, _ = newTestWriter()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.Write([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Finish without any writes sends an empty 200
+	w, buf = newTestWriter()
+	w.SetStatus(StatusOK)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 0\r\n")
+
+	// Test: Finish is a no-op for the explicit API
+	w, buf = newTestWriter()
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "", buf.String())
+}
+
+func TestDiscardBody(t *testing.T) {
+	// Test: Explicit API keeps Content-Length but drops the body
+	w, buf := newTestWriter()
+	w.DiscardBody()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "hello")
+	assert.True(t, w.KeepAlive())
+
+	// Test: Buffered writes report the length they would have sent
+	w, buf = newTestWriter()
+	w.DiscardBody()
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 11\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunk framing and trailers are dropped as well
+	w, buf = newTestWriter()
+	w.DiscardBody()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("")))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteChunkedBodyDone())
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "abc")
+	assert.True(t, w.KeepAlive())
+}
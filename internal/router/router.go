@@ -0,0 +1,233 @@
+package router
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/server"
+)
+
+type segmentKind int
+
+// ordered from least to most specific so matches can be ranked
+const (
+	segmentWildcard segmentKind = iota
+	segmentParam
+	segmentStatic
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+type Router struct {
+	routes     []route
+	middleware []server.Middleware
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers a handler for a pattern such as "GET /users/{id}". The
+// method is optional; without it the route matches every method. A segment
+// written as {name} matches exactly one path segment, while a final {name...}
+// or * matches the rest of the path, which is stored under name or "*".
+// Any middleware given only wraps this route's handler.
+func (rt *Router) Handle(pattern string, handler server.Handler, middleware ...server.Middleware) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("router: pattern must begin with /: %q", pattern))
+	}
+
+	parts := strings.Split(path[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		seg := segment{kind: segmentStatic, value: part}
+		switch {
+		case part == "*":
+			seg = segment{kind: segmentWildcard, value: "*"}
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}"):
+			seg = segment{kind: segmentWildcard, value: part[1 : len(part)-4]}
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			seg = segment{kind: segmentParam, value: part[1 : len(part)-1]}
+		}
+
+		if seg.kind == segmentWildcard && i != len(parts)-1 {
+			panic(fmt.Sprintf("router: wildcard must be the last segment: %q", pattern))
+		}
+		segments = append(segments, seg)
+	}
+
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: segments,
+		handler:  server.Chain(middleware...)(handler),
+	})
+}
+
+// Use adds middleware that wraps every request the router serves, including
+// the 404 and 405 responses it writes itself.
+func (rt *Router) Use(middleware ...server.Middleware) {
+	rt.middleware = append(rt.middleware, middleware...)
+}
+
+func (rt *Router) Handler() server.Handler {
+	return server.Chain(rt.middleware...)(rt.serve)
+}
+
+func (rt *Router) serve(w *response.Writer, req *request.Request) {
+	parts := req.URL.Segments()
+
+	best, bestParams, allowed := rt.find(req.RequestLine.Method, parts)
+
+	// HEAD falls back to the GET handler unless a route handles HEAD itself;
+	// the server discards the body for HEAD responses
+	if best == nil && req.RequestLine.Method == "HEAD" {
+		best, bestParams, _ = rt.find("GET", parts)
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			if slices.Contains(allowed, "GET") && !slices.Contains(allowed, "HEAD") {
+				allowed = append(allowed, "HEAD")
+			}
+			slices.Sort(allowed)
+			writeError(w, response.StatusMethodNotAllowed, strings.Join(allowed, ", "))
+			return
+		}
+		writeError(w, response.StatusNotFound, "")
+		return
+	}
+
+	req.Params = bestParams
+	req.RawParams = best.rawParams(req.URL.RawSegments())
+	best.handler(w, req)
+}
+
+// find returns the most specific route matching method and path, or the
+// methods that would have matched the path when none match the method.
+func (rt *Router) find(method string, parts []string) (*route, map[string]string, []string) {
+	var best *route
+	var bestParams map[string]string
+	var allowed []string
+	for i := range rt.routes {
+		r := &rt.routes[i]
+		params, ok := r.match(parts)
+		if !ok {
+			continue
+		}
+
+		if r.method != "" && r.method != method {
+			if !slices.Contains(allowed, r.method) {
+				allowed = append(allowed, r.method)
+			}
+			continue
+		}
+
+		if best == nil || r.moreSpecific(best) {
+			best, bestParams = r, params
+		}
+	}
+	return best, bestParams, allowed
+}
+
+func (r *route) match(parts []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			params[seg.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case segmentStatic:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// rawParams captures the same parameters as match from the still encoded
+// segments of a path the route is known to match.
+func (r *route) rawParams(rawParts []string) map[string]string {
+	params := make(map[string]string)
+	for i, seg := range r.segments {
+		switch seg.kind {
+		case segmentWildcard:
+			params[seg.value] = strings.Join(rawParts[i:], "/")
+		case segmentParam:
+			params[seg.value] = rawParts[i]
+		}
+	}
+	return params
+}
+
+// moreSpecific ranks two routes matching the same path: the first segment
+// where they differ decides, and a method-specific route beats a catch-all.
+func (r *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind > other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.method != "" && other.method == ""
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, allow string) {
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return
+	}
+
+	var body []byte
+	switch statusCode {
+	case response.StatusNotFound:
+		body = []byte("Not Found\n")
+	case response.StatusMethodNotAllowed:
+		body = []byte("Method Not Allowed\n")
+	}
+
+	h := response.GetDefaultHeaders(len(body))
+	if allow != "" {
+		h.Set("Allow", allow)
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return
+	}
+
+	w.WriteBody(body)
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/server"
+	"github.com/delroscol98/httpfromtcp/internal/servertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func named(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := []byte(name)
+		for _, key := range []string{"id", "rest", "*"} {
+			if value, ok := req.Params[key]; ok {
+				body = append(body, " "+key+"="+value...)
+			}
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Handle("/", named("root"))
+	rt.Handle("GET /users/{id}", named("get-user"))
+	rt.Handle("DELETE /users/{id}", named("delete-user"))
+	rt.Handle("GET /users/me", named("me"))
+	rt.Handle("/files/{rest...}", named("files"))
+	rt.Handle("/static/*", named("static"))
+
+	// Test: Static route
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/", ""), "root"))
+
+	// Test: Path parameter
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/users/42", ""), "get-user id=42"))
+
+	// Test: An encoded slash stays inside its parameter
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/users/a%2Fb", ""), "get-user id=a/b"))
+
+	// Test: Query string is ignored when matching
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/users/42?full=true", ""), "get-user id=42"))
+
+	// Test: Method specific route
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "DELETE", "/users/42", ""), "delete-user id=42"))
+
+	// Test: Static segment beats parameter
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/users/me", ""), "me"))
+
+	// Test: Named and bare wildcards
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/files/a/b/c.txt", ""), "files rest=a/b/c.txt"))
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/static/css/site.css", ""), "static *=css/site.css"))
+
+	// Test: Raw parameters keep the path as it was sent
+	var raw map[string]string
+	rt.Handle("/raw/{id}/{rest...}", func(w *response.Writer, req *request.Request) {
+		raw = req.RawParams
+	})
+	servertest.Serve(t, rt.Handler(), "GET", "/raw/x%20y/anything/a%2Fb/./c", "")
+	assert.Equal(t, map[string]string{"id": "x%20y", "rest": "anything/a%2Fb/c"}, raw)
+
+	// Test: Unknown path
+	res := servertest.Serve(t, rt.Handler(), "GET", "/nope", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Known path with wrong method
+	res = servertest.Serve(t, rt.Handler(), "POST", "/users/42", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: DELETE, GET, HEAD\r\n")
+}
+
+func TestHandleInvalidPattern(t *testing.T) {
+	rt := New()
+	assert.Panics(t, func() { rt.Handle("users", named("x")) })
+	assert.Panics(t, func() { rt.Handle("/files/*/x", named("x")) })
+}
+
+func TestRouterHead(t *testing.T) {
+	rt := New()
+	rt.Handle("GET /video", named("get-video"))
+	rt.Handle("GET /custom", named("get-custom"))
+	rt.Handle("HEAD /custom", named("head-custom"))
+
+	// Test: HEAD runs the GET handler, whose body is discarded
+	res := servertest.Serve(t, rt.Handler(), "HEAD", "/video", "")
+	assert.Contains(t, res, "Content-Length: 9\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+
+	// Test: An explicit HEAD route opts out of the fallback
+	res = servertest.Serve(t, rt.Handler(), "HEAD", "/custom", "")
+	assert.Contains(t, res, "Content-Length: 11\r\n")
+
+	// Test: HEAD is advertised alongside GET
+	res = servertest.Serve(t, rt.Handler(), "POST", "/video", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: GET, HEAD\r\n")
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	deny := func(h server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			writeError(w, response.StatusNotFound, "")
+		}
+	}
+	var statuses []response.StatusCode
+	observe := func(h server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			h(w, req)
+			statuses = append(statuses, w.StatusCode())
+		}
+	}
+
+	rt := New()
+	rt.Use(observe)
+	rt.Handle("GET /admin", named("admin"), deny)
+	rt.Handle("GET /public", named("public"))
+
+	// Test: Route middleware only wraps its own route
+	assert.True(t, strings.HasPrefix(servertest.Serve(t, rt.Handler(), "GET", "/admin", ""), "HTTP/1.1 404 Not Found\r\n"))
+	assert.True(t, strings.HasSuffix(servertest.Serve(t, rt.Handler(), "GET", "/public", ""), "public"))
+
+	// Test: Router middleware also sees the 405 the router writes itself
+	servertest.Serve(t, rt.Handler(), "POST", "/public", "")
+	assert.Equal(t, []response.StatusCode{response.StatusNotFound, response.StatusOK, response.StatusMethodNotAllowed}, statuses)
+}
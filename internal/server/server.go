@@ -1,41 +1,110 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/delroscol98/httpfromtcp/internal/headers"
 	"github.com/delroscol98/httpfromtcp/internal/request"
 	"github.com/delroscol98/httpfromtcp/internal/response"
 )
 
-type HandlerError struct {
-	StatusCode   response.StatusCode
-	ErrorMessage string
+type Server struct {
+	listener          net.Listener
+	handler           Handler
+	requestConfig     request.Config
+	readHeaderTimeout time.Duration
+	readBodyTimeout   time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	headerPriority    []string
+	Closed            atomic.Bool
+	mu                sync.Mutex
+	conns             map[net.Conn]connState
+	shuttingDown      bool
 }
 
-type Handler func(w *response.Writer, req *request.Request)
+type connState int
 
-type Server struct {
-	listener net.Listener
-	handler  Handler
-	Closed   atomic.Bool
+const (
+	connIdle connState = iota
+	connActive
+)
+
+type Option func(*Server)
+
+func WithRequestConfig(config request.Config) Option {
+	return func(s *Server) {
+		s.requestConfig = config
+	}
+}
+
+// WithReadHeaderTimeout limits the time taken to receive the request line and
+// headers, measured from the first byte of the request.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = timeout
+	}
+}
+
+// WithReadBodyTimeout limits the time taken to receive the request body,
+// measured from the end of the headers.
+func WithReadBodyTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readBodyTimeout = timeout
+	}
+}
+
+// WithWriteTimeout limits the time taken to write the response, measured from
+// the end of the request headers.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = timeout
+	}
 }
 
-func (h HandlerError) Error() string {
-	return fmt.Sprintf("Error StatusCode: %d\nError Message: %s", h.StatusCode, h.ErrorMessage)
+// WithIdleTimeout limits how long a keep-alive connection may wait for its
+// next request.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+// WithHeaderPriority sets the response fields written before all others, in
+// the given order, replacing response.DefaultHeaderPriority. Passing no
+// names keeps every field in insertion order.
+func WithHeaderPriority(names ...string) Option {
+	if names == nil {
+		names = []string{}
+	}
+	return func(s *Server) {
+		s.headerPriority = names
+	}
+}
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, errors.New("failed to create listener")
 	}
 	server := Server{
-		listener: listener,
-		handler:  handler,
+		listener:      listener,
+		handler:       handler,
+		requestConfig: request.DefaultConfig(),
+		conns:         make(map[net.Conn]connState),
+	}
+	for _, opt := range opts {
+		opt(&server)
 	}
 
 	go server.listen()
@@ -52,6 +121,63 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Shutdown stops accepting connections, closes idle ones and waits for the
+// requests in progress to finish. Connections still active when ctx is done
+// are closed forcibly and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Close()
+
+	s.mu.Lock()
+	s.shuttingDown = true
+	for conn, state := range s.conns {
+		if state == connIdle {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		remaining := len(s.conns)
+		s.mu.Unlock()
+		if remaining == 0 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for conn := range s.conns {
+				conn.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// setConnState records whether conn is serving a request. It reports false
+// when an idle connection should be closed because the server is shutting
+// down.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == connIdle && s.shuttingDown {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -60,6 +186,7 @@ func (s *Server) listen() {
 				return
 			}
 			log.Printf("error accepting connections: %v", err)
+			continue
 		}
 
 		go func() {
@@ -70,28 +197,165 @@ func (s *Server) listen() {
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	writer := response.Writer{
-		Writer: conn,
-		State:  response.WritingStatusLine,
-	}
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		err := writer.WriteStatusLine(response.StatusBadRequest)
-		if err != nil {
-			log.Fatal(err)
+	defer s.removeConn(conn)
+	reader := request.NewReaderConfig(conn, s.requestConfig)
+
+	for first := true; ; first = false {
+		writer := response.Writer{
+			Writer:         conn,
+			State:          response.WritingStatusLine,
+			HeaderPriority: s.headerPriority,
 		}
 
-		body := fmt.Appendf(make([]byte, 0), "Error parsing request: %v", err)
-		err = writer.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		if !s.setConnState(conn, connIdle) {
+			return
+		}
+		if first {
+			conn.SetReadDeadline(deadline(s.readHeaderTimeout))
+		} else {
+			conn.SetReadDeadline(deadline(s.idleTimeout))
+		}
+		err := reader.Wait()
 		if err != nil {
-			log.Fatal(err)
+			return
 		}
+		s.setConnState(conn, connActive)
 
-		_, err = writer.WriteBody(body)
+		conn.SetReadDeadline(deadline(s.readHeaderTimeout))
+		req, err := reader.ReadRequest()
 		if err != nil {
-			log.Fatal(err)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			statusCode := statusForParseError(err)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				if !errors.Is(err, request.ErrIncompleteRequest) {
+					return
+				}
+				statusCode = response.StatusRequestTimeout
+			}
+
+			conn.SetWriteDeadline(deadline(s.writeTimeout))
+			body := fmt.Appendf(make([]byte, 0), "Error parsing request: %v", err)
+			err := writeError(&writer, statusCode, body)
+			if err != nil {
+				log.Printf("error writing response to %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		conn.SetReadDeadline(deadline(s.readBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.writeTimeout))
+
+		if req.IsHTTP10() {
+			writer.UseHTTP10()
+		}
+		if !req.KeepAlive() {
+			writer.CloseAfterResponse()
+		}
+		if req.RequestLine.Method == "HEAD" {
+			writer.DiscardBody()
+		}
+
+		s.serveRequest(&writer, req)
+		if writer.State == response.WritingTrailers {
+			err = writer.WriteTrailers(headers.NewHeaders())
+			if err != nil {
+				return
+			}
+		}
+
+		err = req.Body.Close()
+		if errors.Is(err, os.ErrDeadlineExceeded) && writer.State == response.WritingStatusLine {
+			body := fmt.Appendf(make([]byte, 0), "Error reading request body: %v", err)
+			err := writeError(&writer, response.StatusRequestTimeout, body)
+			if err != nil {
+				log.Printf("error writing response to %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if err != nil || !writer.KeepAlive() {
+			return
+		}
+	}
+}
+
+// serveRequest runs the handler, recovering from a panic so that it only
+// takes down its own connection. A 500 is sent if nothing has been written
+// yet; otherwise the partial response is abandoned.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+
+		log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, p, debug.Stack())
+		w.CloseAfterResponse()
+		if w.State == response.WritingStatusLine {
+			err := writeError(w, response.StatusInternalServerError, []byte("Internal Server Error"))
+			if err != nil {
+				log.Printf("error writing response: %v", err)
+			}
 		}
+	}()
+
+	s.handler(w, req)
+
+	err := w.Finish()
+	if err != nil {
+		log.Printf("error finishing response for %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+		w.CloseAfterResponse()
+		if w.State == response.WritingStatusLine {
+			err = writeError(w, response.StatusInternalServerError, []byte("Internal Server Error"))
+			if err != nil {
+				log.Printf("error writing response: %v", err)
+			}
+		}
+	}
+}
+
+// writeError sends a complete plain-text response and marks the connection to
+// be closed afterwards.
+func writeError(w *response.Writer, statusCode response.StatusCode, body []byte) error {
+	w.CloseAfterResponse()
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	if err != nil {
+		return err
 	}
 
-	s.handler(&writer, req)
+	_, err = w.WriteBody(body)
+	return err
+}
+
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func statusForParseError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding):
+		return response.StatusNotImplemented
+	case errors.Is(err, request.ErrUnsupportedContentEncoding):
+		return response.StatusUnsupportedMediaType
+	case errors.Is(err, request.ErrURITooLong):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusContentTooLarge
+	case errors.Is(err, headers.ErrHeaderTooLarge):
+		return response.StatusRequestHeaderFieldsTooLarge
+	default:
+		return response.StatusBadRequest
+	}
 }
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+)
+
+// Compress returns middleware that compresses bodies written through the
+// Writer's io.Writer mode with gzip or deflate when the request's
+// Accept-Encoding allows it. Responses written with WriteStatusLine,
+// WriteHeaders and WriteBody are sent unchanged.
+func Compress(opts response.CompressOptions) Middleware {
+	return func(h Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+			w.Compress(acceptEncoding, opts)
+			h(w, req)
+		}
+	}
+}
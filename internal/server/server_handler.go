@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+)
+
+type HandlerError struct {
+	StatusCode   response.StatusCode
+	ErrorMessage string
+}
+
+type Handler func(w *response.Writer, req *request.Request)
+
+// ErrorHandler is a handler that reports failure by returning an error
+// instead of writing the error response itself. Wrap it with HandleErrors.
+type ErrorHandler func(w *response.Writer, req *request.Request) error
+
+func (h HandlerError) Error() string {
+	return fmt.Sprintf("Error StatusCode: %d\nError Message: %s", h.StatusCode, h.ErrorMessage)
+}
+
+// HandleErrors adapts an ErrorHandler to a Handler. A returned HandlerError,
+// possibly wrapped, is rendered with its status code and message; any other
+// error becomes a 500. Errors returned after the status line has been written
+// can no longer be reported to the client, so they are logged and the
+// connection is closed.
+func HandleErrors(h ErrorHandler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		err := h(w, req)
+		if err == nil {
+			return
+		}
+
+		if w.State != response.WritingStatusLine {
+			log.Printf("error after response started for %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+			w.CloseAfterResponse()
+			return
+		}
+
+		handlerErr, ok := asHandlerError(err)
+		if !ok {
+			log.Printf("error serving %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+			handlerErr = HandlerError{
+				StatusCode:   response.StatusInternalServerError,
+				ErrorMessage: "The server encountered an unexpected error.",
+			}
+		}
+
+		err = writeHandlerError(w, handlerErr)
+		if err != nil {
+			log.Printf("error writing response: %v", err)
+		}
+	}
+}
+
+func asHandlerError(err error) (HandlerError, bool) {
+	var handlerErr HandlerError
+	if errors.As(err, &handlerErr) {
+		return handlerErr, true
+	}
+
+	var handlerErrPtr *HandlerError
+	if errors.As(err, &handlerErrPtr) && handlerErrPtr != nil {
+		return *handlerErrPtr, true
+	}
+
+	return HandlerError{}, false
+}
+
+func writeHandlerError(w *response.Writer, handlerErr HandlerError) error {
+	if !response.ValidStatusCode(handlerErr.StatusCode) {
+		handlerErr.StatusCode = response.StatusInternalServerError
+	}
+
+	err := w.WriteStatusLine(handlerErr.StatusCode)
+	if err != nil {
+		return err
+	}
+
+	reasonPhrase := html.EscapeString(response.StatusText(handlerErr.StatusCode))
+	if reasonPhrase == "" {
+		reasonPhrase = "Error"
+	}
+	body := fmt.Appendf(make([]byte, 0), `<html>
+  <head>
+    <title>%d %s</title>
+  </head>
+  <body>
+    <h1>%s</h1>
+    <p>%s</p>
+  </body>
+</html>`, handlerErr.StatusCode, reasonPhrase, reasonPhrase, html.EscapeString(handlerErr.ErrorMessage))
+
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html")
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteBody(body)
+	return err
+}
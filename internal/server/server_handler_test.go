@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/servertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleErrors(t *testing.T) {
+	// Test: HandlerError renders its status code and message
+	res := servertest.Serve(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		return HandlerError{StatusCode: response.StatusNotFound, ErrorMessage: "No <such> thing"}
+	}), "GET", "/", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, res, "<p>No &lt;such&gt; thing</p>")
+
+	// Test: Wrapped HandlerError
+	res = servertest.Serve(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		return fmt.Errorf("loading user: %w", &HandlerError{StatusCode: response.StatusBadRequest, ErrorMessage: "bad id"})
+	}), "GET", "/", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, res, "<p>bad id</p>")
+
+	// Test: Any other error becomes a 500
+	res = servertest.Serve(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		return errors.New("database is down")
+	}), "GET", "/", "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, res, "database is down")
+
+	// Test: Errors after the response started are not rendered
+	res = servertest.Serve(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		return errors.New("too late")
+	}), "GET", "/", "")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", res)
+
+	// Test: No error leaves the response alone
+	res = servertest.Serve(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		return nil
+	}), "GET", "/", "")
+	assert.Equal(t, "", res)
+}
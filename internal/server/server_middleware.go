@@ -0,0 +1,44 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler with behaviour that runs before and after it,
+// such as logging or compression.
+type Middleware func(Handler) Handler
+
+// Chain combines middleware into one. The first middleware is the outermost,
+// so it sees the request first and the finished response last.
+func Chain(middleware ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			h = middleware[i](h)
+		}
+		return h
+	}
+}
+
+// Logger logs the method, target, status code, content size and duration of
+// every request. It finishes the response once the handler returns, as
+// buffered output is only sent then.
+func Logger(logger *log.Logger) Middleware {
+	return func(h Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			h(w, req)
+
+			err := w.Finish()
+			if err != nil {
+				logger.Printf("error finishing response for %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+				w.CloseAfterResponse()
+			}
+
+			logger.Printf("%s %s %d %d %v", req.RequestLine.Method, req.RequestLine.RequestTarget, w.StatusCode(), w.BytesWritten(), time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/delroscol98/httpfromtcp/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" before")
+				h(w, req)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	h := Chain(trace("outer"), trace("inner"))(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	})
+
+	servertest.Serve(t, h, "GET", "/path", "")
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+
+	// Test: An empty chain returns the handler unchanged
+	calls = nil
+	servertest.Serve(t, Chain()(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	}), "GET", "/path", "")
+	assert.Equal(t, []string{"handler"}, calls)
+}
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := Logger(log.New(&logs, "", 0))
+
+	// Test: Buffered output is finished so the status and size are known
+	res := servertest.Serve(t, logger(func(w *response.Writer, req *request.Request) {
+		w.SetStatus(response.StatusCreated)
+		io.WriteString(w, "created")
+	}), "GET", "/path", "")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ncreated"))
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /path 201 7 "))
+
+	// Test: Responses written directly and bodies discarded for HEAD
+	logs.Reset()
+	servertest.Serve(t, logger(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusNotFound)
+		w.WriteHeaders(response.GetDefaultHeaders(9))
+		w.WriteBody([]byte("not found"))
+	}), "HEAD", "/path", "")
+	assert.True(t, strings.HasPrefix(logs.String(), "HEAD /path 404 0 "))
+
+	// Test: Finish errors go to the same logger
+	logs.Reset()
+	req, err := request.RequestFromReader(strings.NewReader("GET /path HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	w := response.Writer{Writer: io.Discard, State: response.WritingStatusLine}
+	logger(func(w *response.Writer, req *request.Request) {
+		w.Header().Set("X-Bad", "a\x00b")
+		io.WriteString(w, "body")
+	})(&w, req)
+	assert.True(t, strings.HasPrefix(logs.String(), "error finishing response for GET /path: "))
+	assert.False(t, w.KeepAlive())
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	h := Chain(Logger(log.New(&logs, "", 0)), Compress(response.CompressOptions{}))(func(w *response.Writer, req *request.Request) {
+		io.WriteString(w, strings.Repeat("compress me ", 100))
+	})
+
+	req, err := request.RequestFromReader(strings.NewReader("GET /path HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.Writer{Writer: &buf, State: response.WritingStatusLine}
+	h(&w, req)
+	require.NoError(t, w.Finish())
+
+	// Test: Compress composes with other middleware
+	assert.Contains(t, buf.String(), "Content-Encoding: gzip\r\n")
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /path 200 "))
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, h Handler, opts ...Option) *Server {
+	t.Helper()
+	s, err := Serve(0, h, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// dial opens a client connection to s and wraps it in a reader for the
+// responses.
+func dial(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	port := s.listener.Addr().(*net.TCPAddr).Port
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func readResponse(t *testing.T, br *bufio.Reader) (*http.Response, string) {
+	t.Helper()
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+// assertClosed checks that the server closed the connection without sending
+// anything more.
+func assertClosed(t *testing.T, br *bufio.Reader) {
+	t.Helper()
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	if req.RequestLine.RequestTarget == "/close" {
+		w.CloseAfterResponse()
+	}
+	io.WriteString(w, req.RequestLine.RequestTarget)
+}
+
+func TestKeepAlive(t *testing.T) {
+	s := startServer(t, echoTarget)
+
+	// Test: Pipelined requests are answered in order on one connection
+	conn, br := dial(t, s)
+	_, err := io.WriteString(conn, "GET /a HTTP/1.1\r\n\r\nGET /b HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	for _, target := range []string{"/a", "/b"} {
+		res, body := readResponse(t, br)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.False(t, res.Close)
+		assert.Equal(t, target, body)
+	}
+
+	// Test: An unread body is skipped before the next request
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET /next HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	_, body := readResponse(t, br)
+	assert.Equal(t, "/upload", body)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "/next", body)
+
+	// Test: Connection: close from the client ends the connection
+	_, err = io.WriteString(conn, "GET /last HTTP/1.1\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.True(t, res.Close)
+	assert.Equal(t, "/last", body)
+	assertClosed(t, br)
+
+	// Test: Connection: close from the handler ends the connection
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "GET /close HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	res, body = readResponse(t, br)
+	assert.True(t, res.Close)
+	assert.Equal(t, "/close", body)
+	assertClosed(t, br)
+}
+
+func TestTimeouts(t *testing.T) {
+	readBody := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		w.Write(body)
+	}
+	s := startServer(t, readBody,
+		WithReadHeaderTimeout(100*time.Millisecond),
+		WithReadBodyTimeout(100*time.Millisecond),
+		WithIdleTimeout(100*time.Millisecond),
+	)
+
+	// Test: A stalled request line gets a 408
+	conn, br := dial(t, s)
+	_, err := io.WriteString(conn, "GET / HT")
+	require.NoError(t, err)
+	res, _ := readResponse(t, br)
+	assert.Equal(t, 408, res.StatusCode)
+	assert.True(t, res.Close)
+	assertClosed(t, br)
+
+	// Test: An idle keep-alive connection is closed
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nContent-Length: 2\r\n\r\nhi")
+	require.NoError(t, err)
+	_, body := readResponse(t, br)
+	assert.Equal(t, "hi", body)
+	start := time.Now()
+	assertClosed(t, br)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Test: A stalled body gets a 408
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nabc")
+	require.NoError(t, err)
+	res, _ = readResponse(t, br)
+	assert.Equal(t, 408, res.StatusCode)
+	assertClosed(t, br)
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		io.WriteString(w, "done")
+	}
+
+	// Test: An in-flight request finishes before Shutdown returns
+	s := startServer(t, handler)
+	conn, br := dial(t, s)
+	_, err := io.WriteString(conn, "GET /slow HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned while a request was in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release <- struct{}{}
+
+	_, body := readResponse(t, br)
+	assert.Equal(t, "done", body)
+	assert.NoError(t, <-shutdown)
+	assertClosed(t, br)
+
+	// Test: An idle keep-alive connection is closed at once
+	s = startServer(t, handler)
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	readResponse(t, br)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	assertClosed(t, br)
+
+	// Test: Connections still active at the deadline are closed
+	s = startServer(t, handler)
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assertClosed(t, br)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	written := make(chan error, 1)
+	handler := func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("boom")
+		case "/partial":
+			io.WriteString(w, "partial")
+			w.Flush()
+			panic("boom")
+		case "/big":
+			chunk := []byte(strings.Repeat("x", 64<<10))
+			var err error
+			for i := 0; i < 1024 && err == nil; i++ {
+				_, err = w.Write(chunk)
+			}
+			written <- err
+		default:
+			io.WriteString(w, "ok")
+		}
+	}
+	s := startServer(t, handler)
+
+	// Test: A panic before anything is written sends a 500 and closes
+	conn, br := dial(t, s)
+	_, err := io.WriteString(conn, "GET /panic HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, br)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.True(t, res.Close)
+	assertClosed(t, br)
+
+	// Test: A panic after the body started drops the connection
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "GET /partial HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "partial", string(body))
+
+	// Test: A write error only ends its own connection
+	conn, _ = dial(t, s)
+	_, err = io.WriteString(conn, "GET /big HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	conn.Close()
+	assert.Error(t, <-written)
+
+	conn, br = dial(t, s)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	_, ok := readResponse(t, br)
+	assert.Equal(t, "ok", ok)
+}
@@ -0,0 +1,32 @@
+// Package servertest runs handlers against a single request without a
+// connection, for use in tests.
+package servertest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/delroscol98/httpfromtcp/internal/request"
+	"github.com/delroscol98/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/require"
+)
+
+// Serve parses a request for method and target, with requestHeaders given
+// as CRLF-terminated field lines, and runs h on it the way the server does:
+// the body is discarded for HEAD and the response is finished once h
+// returns. It returns everything written.
+func Serve(t testing.TB, h func(w *response.Writer, req *request.Request), method, target, requestHeaders string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\n" + requestHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := response.Writer{Writer: &buf, State: response.WritingStatusLine}
+	if method == "HEAD" {
+		w.DiscardBody()
+	}
+	h(&w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}